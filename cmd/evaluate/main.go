@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+	"github.com/pomo-mondreganto/goas/internal/bot"
+	"github.com/pomo-mondreganto/goas/internal/evaluation"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// maxHashDistance is the largest possible distance between perception hashes.
+const maxHashDistance = 64
+
+var (
+	corpus               = pflag.StringP("corpus", "c", "corpus", "Directory with spam and ham image subdirectories")
+	texts                = pflag.StringP("texts", "t", "", "JSON lines file with labeled texts")
+	samples              = pflag.StringP("samples", "s", "resources/samples", "Spam samples directory")
+	dictionary           = pflag.String("dictionary", "resources/banlist.txt", "Path to banned patterns text file")
+	interestingThreshold = pflag.Int("interesting_threshold", 10, "Threshold to consider new sample interesting")
+	suspiciousThreshold  = pflag.Int("suspicious_threshold", 15, "Threshold to consider an image suspicious")
+	jsonReport           = pflag.String("json", "", "Path to write the JSON report to")
+)
+
+type labeledText struct {
+	Text      string                   `json:"text"`
+	Entities  []tgbotapi.MessageEntity `json:"entities,omitempty"`
+	Forwarded bool                     `json:"forwarded,omitempty"`
+	Spam      bool                     `json:"spam"`
+}
+
+type report struct {
+	Time      time.Time             `json:"time"`
+	Detectors []evaluation.Result   `json:"detectors"`
+	ImageROC  []evaluation.ROCPoint `json:"image_roc,omitempty"`
+}
+
+func main() {
+	pflag.Parse()
+	logrus.SetLevel(logrus.WarnLevel)
+
+	r := report{Time: time.Now()}
+
+	m, err := imgmatch.NewMatcher(*samples, *interestingThreshold, *suspiciousThreshold)
+	if err != nil {
+		logrus.Fatalf("Error creating image matcher: %v", err)
+	}
+	distances := evaluateImages(m)
+	if len(distances) > 0 {
+		var c evaluation.Confusion
+		for _, d := range distances {
+			c.Add(d.Value <= m.SuspiciousThreshold(), d.Spam)
+		}
+		r.Detectors = append(r.Detectors, evaluation.NewResult("imgmatch", c))
+		r.ImageROC = evaluation.SweepThresholds(distances, maxHashDistance)
+	}
+
+	if *texts != "" {
+		l, err := banlist.New(*dictionary)
+		if err != nil {
+			logrus.Fatalf("Error creating dictionary: %v", err)
+		}
+		var c evaluation.Confusion
+		for _, t := range readTexts(*texts) {
+			c.Add(bot.TextScore(l, t.message()) >= bot.BaseSpamThreshold, t.Spam)
+		}
+		r.Detectors = append(r.Detectors, evaluation.NewResult("text", c))
+	}
+
+	printReport(r)
+
+	if *jsonReport != "" {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			logrus.Fatalf("Error serializing report: %v", err)
+		}
+		if err := os.WriteFile(*jsonReport, data, 0644); err != nil {
+			logrus.Fatalf("Error writing report: %v", err)
+		}
+	}
+}
+
+func evaluateImages(m *imgmatch.Matcher) []evaluation.Distance {
+	var distances []evaluation.Distance
+	for _, label := range []string{"spam", "ham"} {
+		dir := filepath.Join(*corpus, label)
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			logrus.Fatalf("Error listing %s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			img, err := imgmatch.LoadImage(path)
+			if err != nil {
+				logrus.Warningf("Skipping %s: %v", path, err)
+				continue
+			}
+			name, dist, err := m.ClosestSample(img)
+			if err != nil {
+				logrus.Fatalf("Error matching %s: %v", path, err)
+			}
+			if name == "" {
+				dist = maxHashDistance
+			}
+			distances = append(distances, evaluation.Distance{Value: dist, Spam: label == "spam"})
+		}
+	}
+	return distances
+}
+
+func readTexts(path string) []labeledText {
+	f, err := os.Open(path)
+	if err != nil {
+		logrus.Fatalf("Error opening texts: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	var result []labeledText
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var t labeledText
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			logrus.Fatalf("Error parsing texts line %d: %v", line, err)
+		}
+		result = append(result, t)
+	}
+	if err := scanner.Err(); err != nil {
+		logrus.Fatalf("Error reading texts: %v", err)
+	}
+	return result
+}
+
+// message builds the message the bot would receive for the labeled text.
+func (t labeledText) message() *tgbotapi.Message {
+	msg := &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{},
+		Text:     t.Text,
+		Entities: t.Entities,
+	}
+	if t.Forwarded {
+		msg.ForwardDate = int(time.Now().Unix())
+	}
+	return msg
+}
+
+func printReport(r report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DETECTOR\tSAMPLES\tTP\tFP\tTN\tFN\tPRECISION\tRECALL\tF1")
+	for _, d := range r.Detectors {
+		c := d.Confusion
+		fmt.Fprintf(
+			w,
+			"%s\t%d\t%d\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\n",
+			d.Detector, d.Samples,
+			c.TruePositive, c.FalsePositive, c.TrueNegative, c.FalseNegative,
+			d.Precision, d.Recall, d.F1,
+		)
+	}
+	_ = w.Flush()
+
+	if len(r.ImageROC) == 0 {
+		return
+	}
+	fmt.Println("\nImage threshold sweep:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "THRESHOLD\tTPR\tFPR\tPRECISION\tF1")
+	for _, p := range r.ImageROC {
+		fmt.Fprintf(w, "%d\t%.3f\t%.3f\t%.3f\t%.3f\n", p.Threshold, p.TruePositiveRate, p.FalsePositiveRate, p.Precision, p.F1)
+	}
+	_ = w.Flush()
+}
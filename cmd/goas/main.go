@@ -7,11 +7,14 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/pomo-mondreganto/goas/internal/banlist"
 	"github.com/pomo-mondreganto/goas/internal/bot"
 	"github.com/pomo-mondreganto/goas/internal/config"
+	"github.com/pomo-mondreganto/goas/internal/dashboard"
 	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
 	"github.com/pomo-mondreganto/goas/internal/storage"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -28,6 +31,8 @@ func main() {
 	l := createDictionary(cfg)
 	m := createImageMatcher(cfg)
 	b := createBot(ctx, cfg, s, l, m)
+	metricsDone := serveMetrics(ctx, cfg, s, b)
+	dashboardDone := serveDashboard(ctx, cfg, s, m, l, b)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
@@ -36,17 +41,27 @@ func main() {
 	cancel()
 
 	b.Wait()
+	<-metricsDone
+	<-dashboardDone
 
 	logrus.Info("Shutdown successful")
 }
 
 func setupConfig() *config.Config {
 	pflag.String("log_level", "INFO", "Log level {INFO|DEBUG|WARNING|ERROR}")
+	pflag.String("log_format", "text", "Log format {text|json}")
+	pflag.Bool("log_redact_content", false, "Keep message texts and links out of the logs")
+	pflag.Bool("log_redact_names", false, "Keep user and chat names out of the logs")
 	pflag.StringP("data", "d", "data", "Data directory")
 	pflag.StringP("samples", "s", "resources", "Spam samples directory")
 	pflag.String("dictionary", "banlist.txt", "Path to banned patterns text file")
 	pflag.Int("interesting_threshold", 10, "Threshold to consider new sample interesting")
 	pflag.Int("suspicious_threshold", 15, "Threshold to consider an image suspicious")
+	pflag.String("api_endpoint", "https://api.telegram.org", "Telegram Bot API server URL")
+	pflag.String("record", "", "Archive to record incoming updates and files to")
+	pflag.String("metrics_addr", "", "Address to serve metrics and health checks on, e.g. :9090, disabled if empty")
+	pflag.String("dashboard_addr", "", "Address to serve the admin dashboard on, e.g. :8080, disabled if empty")
+	pflag.StringSlice("dashboard_tokens", nil, "Static tokens for the dashboard API, comma separated")
 
 	pflag.Parse()
 
@@ -58,14 +73,15 @@ func setupConfig() *config.Config {
 		logrus.Fatalf("Error binding env: %v", err)
 	}
 	viper.AutomaticEnv()
+	// The logger is set up before the config is read, so that its lines are formatted too.
 	setLogLevel(viper.GetString("log_level"))
+	setLogFormat(viper.GetString("log_format"))
 	return config.Get()
 }
 
 func initLogger() {
 	mainFormatter := &logrus.TextFormatter{}
 	mainFormatter.FullTimestamp = true
-	mainFormatter.ForceColors = true
 	mainFormatter.PadLevelText = true
 	mainFormatter.TimestampFormat = "2006-01-02 15:04:05"
 	logrus.SetFormatter(mainFormatter)
@@ -89,6 +105,18 @@ func setLogLevel(level string) {
 	}
 }
 
+func setLogFormat(format string) {
+	switch strings.ToLower(format) {
+	case "text":
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	default:
+		logrus.Errorf("Invalid log format provided: %s", format)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
 func createStorage(cfg *config.Config) *storage.Storage {
 	s, err := storage.New(cfg.Data)
 	if err != nil {
@@ -104,13 +132,60 @@ func createBot(
 	l *banlist.BanList,
 	m *imgmatch.Matcher,
 ) *bot.Bot {
-	b, err := bot.New(ctx, cfg.Token, cfg.Debug, s, l, m)
+	b, err := bot.New(ctx, cfg, s, l, m)
 	if err != nil {
 		logrus.Fatalf("Error creating bot: %v", err)
 	}
 	return b
 }
 
+// serveMetrics serves the metrics until the context is cancelled, the returned channel is closed then.
+func serveMetrics(ctx context.Context, cfg *config.Config, s *storage.Storage, b *bot.Bot) <-chan struct{} {
+	done := make(chan struct{})
+	if cfg.MetricsAddr == "" {
+		close(done)
+		return done
+	}
+	srv := metrics.NewServer(cfg.MetricsAddr, []metrics.Check{b.Alive}, []metrics.Check{s.Ping})
+	go func() {
+		defer close(done)
+		if err := srv.Run(ctx); err != nil {
+			logrus.Errorf("Error serving metrics: %v", err)
+		}
+	}()
+	return done
+}
+
+// serveDashboard serves the dashboard until the context is cancelled, the returned channel is closed then.
+func serveDashboard(
+	ctx context.Context,
+	cfg *config.Config,
+	s *storage.Storage,
+	m *imgmatch.Matcher,
+	l *banlist.BanList,
+	b *bot.Bot,
+) <-chan struct{} {
+	done := make(chan struct{})
+	if cfg.DashboardAddr == "" {
+		close(done)
+		return done
+	}
+	srv := dashboard.New(dashboard.Config{
+		Addr:        cfg.DashboardAddr,
+		Tokens:      cfg.DashboardTokens,
+		BotToken:    cfg.Token,
+		BotUserName: b.UserName(),
+		SamplesDir:  cfg.Samples,
+	}, s, m, l)
+	go func() {
+		defer close(done)
+		if err := srv.Run(ctx); err != nil {
+			logrus.Errorf("Error serving dashboard: %v", err)
+		}
+	}()
+	return done
+}
+
 func createDictionary(cfg *config.Config) *banlist.BanList {
 	l, err := banlist.New(cfg.Dictionary)
 	if err != nil {
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+)
+
+// The allowlist is stored in the samples directory and loaded with the matcher,
+// the bot picks up the changes after a restart.
+
+func allowlistListCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("allowlist list")
+	_ = fs.Parse(args)
+
+	m, err := imgmatch.NewMatcher(*dir, 0, 0)
+	if err != nil {
+		return fmt.Errorf("loading samples: %w", err)
+	}
+	names := m.Allowlist()
+	if *jsonOutput {
+		return printJSON(names)
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func allowlistAddCommand(args []string) error {
+	fs, _, dir := samplesFlags("allowlist add")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: goasctl allowlist add [flags] <image>...")
+	}
+
+	m, err := imgmatch.NewMatcher(*dir, 0, 0)
+	if err != nil {
+		return fmt.Errorf("loading samples: %w", err)
+	}
+	images, err := loadImages(fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		name := filepath.Base(img.Path)
+		if err := m.Allow(name, img.img); err != nil {
+			return fmt.Errorf("allowlisting %s: %w", img.Path, err)
+		}
+		fmt.Printf("Allowlisted %s as %s\n", img.Path, name)
+	}
+	return nil
+}
+
+func allowlistRemoveCommand(args []string) error {
+	fs, _, dir := samplesFlags("allowlist remove")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: goasctl allowlist remove [flags] <name>...")
+	}
+
+	m, err := imgmatch.NewMatcher(*dir, 0, 0)
+	if err != nil {
+		return fmt.Errorf("loading samples: %w", err)
+	}
+	for _, name := range fs.Args() {
+		removed, err := m.Disallow(name)
+		if err != nil {
+			return fmt.Errorf("removing %s: %w", name, err)
+		}
+		if !removed {
+			return fmt.Errorf("%s is not allowlisted", name)
+		}
+		fmt.Printf("Removed %s\n", name)
+	}
+	return nil
+}
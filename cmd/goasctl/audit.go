@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func auditCommand(args []string) error {
+	fs, jsonOutput := newFlagSet("audit")
+	dataDir := fs.StringP("data", "d", "data", "Data directory")
+	chatID := fs.Int64("chat", 0, "Only show entries of the chat")
+	limit := fs.Int("limit", 50, "Show this many latest entries, 0 for all")
+	_ = fs.Parse(args)
+
+	s, closeStorage, err := openStorageReadOnly(*dataDir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	entries, err := s.GetAuditEntries(*chatID, *limit)
+	if err != nil {
+		return fmt.Errorf("getting audit entries: %w", err)
+	}
+	if *jsonOutput {
+		return printJSON(entries)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCHAT\tACTION\tTARGET\tSHADOW\tDETAILS")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%t\t%s\n", formatTime(e.Time), e.ChatID, e.Action, e.Target, e.Shadow, e.Details)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+)
+
+// banlistTestCommand checks the arguments, or stdin lines if there are none.
+func banlistTestCommand(args []string) error {
+	fs, jsonOutput := newFlagSet("banlist test")
+	dictionary := fs.String("dictionary", "resources/banlist.txt", "Path to banned patterns text file")
+	_ = fs.Parse(args)
+
+	l, err := banlist.New(*dictionary)
+	if err != nil {
+		return fmt.Errorf("loading dictionary: %w", err)
+	}
+
+	texts := fs.Args()
+	if len(texts) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			texts = append(texts, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+	}
+
+	type result struct {
+		Text    string   `json:"text"`
+		Matches []string `json:"matches"`
+	}
+	results := make([]result, 0, len(texts))
+	for _, text := range texts {
+		matches := l.Matches(text)
+		if matches == nil {
+			matches = []string{}
+		}
+		results = append(results, result{text, matches})
+	}
+
+	if *jsonOutput {
+		return printJSON(results)
+	}
+	for _, r := range results {
+		fmt.Printf("%q: %d matches %v\n", r.Text, len(r.Matches), r.Matches)
+	}
+	return nil
+}
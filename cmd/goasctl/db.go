@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/spf13/pflag"
+)
+
+func dbFlags(name string) (*pflag.FlagSet, *bool, *string) {
+	fs, jsonOutput := newFlagSet(name)
+	dir := fs.StringP("data", "d", "data", "Data directory")
+	return fs, jsonOutput, dir
+}
+
+func openStorage(dir string) (*storage.Storage, func(), error) {
+	s, err := storage.New(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening storage (is the bot running?): %w", err)
+	}
+	return s, func() { _ = s.Close() }, nil
+}
+
+// openStorageReadOnly opens the storage without changing it, for the commands that only read.
+func openStorageReadOnly(dir string) (*storage.Storage, func(), error) {
+	s, err := storage.OpenReadOnly(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening storage (is the bot running?): %w", err)
+	}
+	return s, func() { _ = s.Close() }, nil
+}
+
+func dbInspectCommand(args []string) error {
+	fs, jsonOutput, dir := dbFlags("db inspect")
+	_ = fs.Parse(args)
+
+	s, closeStorage, err := openStorageReadOnly(*dir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	stats, err := s.Stats()
+	if err != nil {
+		return fmt.Errorf("getting stats: %w", err)
+	}
+	if *jsonOutput {
+		return printJSON(stats)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tKEYS\tNESTED BUCKETS")
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", st.Name, st.Keys, st.Buckets)
+	}
+	return w.Flush()
+}
+
+func dbExportCommand(args []string) error {
+	fs, _, dir := dbFlags("db export")
+	output := fs.StringP("output", "o", "-", "File to export to")
+	_ = fs.Parse(args)
+
+	s, closeStorage, err := openStorageReadOnly(*dir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	w := os.Stdout
+	if *output != "-" {
+		if w, err = os.Create(*output); err != nil {
+			return fmt.Errorf("creating output: %w", err)
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer w.Close()
+	}
+	if err := s.Export(w); err != nil {
+		return fmt.Errorf("exporting: %w", err)
+	}
+	return nil
+}
+
+func dbCompactCommand(args []string) error {
+	fs, _, dir := dbFlags("db compact")
+	_ = fs.Parse(args)
+
+	s, closeStorage, err := openStorage(*dir)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(*dir, "data.db")
+	tmp := path + ".compact"
+	if err := s.Compact(tmp); err != nil {
+		closeStorage()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("compacting: %w", err)
+	}
+	// The database has to be closed and unlocked before it's replaced.
+	if err := s.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("closing database: %w", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("checking database: %w", err)
+	}
+	after, err := os.Stat(tmp)
+	if err != nil {
+		return fmt.Errorf("checking compacted database: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replacing database: %w", err)
+	}
+	fmt.Printf("Compacted %d bytes to %d bytes\n", before.Size(), after.Size())
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/corona10/goimagehash"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+)
+
+type hashedImage struct {
+	Path string `json:"path"`
+	Hash uint64 `json:"hash"`
+	Hex  string `json:"hex"`
+
+	img  image.Image
+	hash *goimagehash.ImageHash
+}
+
+func hashCommand(args []string) error {
+	fs, jsonOutput := newFlagSet("hash")
+	_ = fs.Parse(args)
+
+	images, err := loadImages(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(images)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, img := range images {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", img.Path, img.Hash, img.Hex)
+	}
+	return w.Flush()
+}
+
+func compareCommand(args []string) error {
+	fs, jsonOutput := newFlagSet("compare")
+	_ = fs.Parse(args)
+
+	images, err := loadImages(fs.Args())
+	if err != nil {
+		return err
+	}
+	matrix := make([][]int, len(images))
+	for i := range images {
+		matrix[i] = make([]int, len(images))
+		for j := range images {
+			if matrix[i][j], err = images[i].hash.Distance(images[j].hash); err != nil {
+				return fmt.Errorf("calculating distance: %w", err)
+			}
+		}
+	}
+
+	if *jsonOutput {
+		paths := make([]string, 0, len(images))
+		for _, img := range images {
+			paths = append(paths, img.Path)
+		}
+		return printJSON(struct {
+			Paths     []string `json:"paths"`
+			Distances [][]int  `json:"distances"`
+		}{paths, matrix})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "\t")
+	for i := range images {
+		fmt.Fprintf(w, "%d\t", i)
+	}
+	fmt.Fprintln(w)
+	for i, row := range matrix {
+		fmt.Fprintf(w, "%d\t", i)
+		for _, d := range row {
+			fmt.Fprintf(w, "%d\t", d)
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	for i, img := range images {
+		fmt.Printf("%d: %s\n", i, img.Path)
+	}
+	return nil
+}
+
+// loadImages loads and hashes images from files, directories,
+// or stdin if the path is "-".
+func loadImages(paths []string) ([]*hashedImage, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	var result []*hashedImage
+	for _, path := range paths {
+		files, err := expandPath(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			img, err := loadImage(file)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, img)
+		}
+	}
+	return result, nil
+}
+
+func expandPath(path string) ([]string, error) {
+	if path == "-" {
+		return []string{path}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("checking %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", path, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	return files, nil
+}
+
+func loadImage(path string) (*hashedImage, error) {
+	var (
+		img image.Image
+		err error
+	)
+	if path == "-" {
+		img, err = imgmatch.Decode(os.Stdin)
+	} else {
+		img, err = imgmatch.LoadImage(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	hash, err := imgmatch.Hash(img)
+	if err != nil {
+		return nil, fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return &hashedImage{
+		Path: path,
+		Hash: hash.GetHash(),
+		Hex:  hash.ToString(),
+		img:  img,
+		hash: hash,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"audit":   auditCommand,
+	"hash":    hashCommand,
+	"compare": compareCommand,
+	"samples": group("samples", map[string]command{
+		"list":    samplesListCommand,
+		"stats":   samplesStatsCommand,
+		"cluster": samplesClusterCommand,
+		"dedupe":  samplesDedupeCommand,
+		"prune":   samplesPruneCommand,
+		"remove":  samplesRemoveCommand,
+		"import":  samplesImportCommand,
+	}),
+	"allowlist": group("allowlist", map[string]command{
+		"list":   allowlistListCommand,
+		"add":    allowlistAddCommand,
+		"remove": allowlistRemoveCommand,
+	}),
+	"db": group("db", map[string]command{
+		"inspect": dbInspectCommand,
+		"export":  dbExportCommand,
+		"compact": dbCompactCommand,
+	}),
+	"banlist": group("banlist", map[string]command{
+		"test": banlistTestCommand,
+	}),
+	"users": group("users", map[string]command{
+		"show":    usersShowCommand,
+		"trust":   usersTrustCommand,
+		"untrust": usersUntrustCommand,
+		"trusted": usersTrustedCommand,
+	}),
+}
+
+func main() {
+	logrus.SetLevel(logrus.WarnLevel)
+	if len(os.Args) < 2 {
+		usage("goasctl", commands)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage("goasctl", commands)
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		logrus.Fatalf("Error: %v", err)
+	}
+}
+
+func group(name string, subcommands map[string]command) command {
+	return func(args []string) error {
+		if len(args) == 0 {
+			usage("goasctl "+name, subcommands)
+		}
+		cmd, ok := subcommands[args[0]]
+		if !ok {
+			usage("goasctl "+name, subcommands)
+		}
+		return cmd(args[1:])
+	}
+}
+
+func usage(prefix string, cmds map[string]command) {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s {%s} [flags]\n", prefix, strings.Join(names, "|"))
+	os.Exit(2)
+}
+
+func newFlagSet(name string) (*pflag.FlagSet, *bool) {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Print machine-readable JSON output")
+	return fs, jsonOutput
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encoding output: %w", err)
+	}
+	return nil
+}
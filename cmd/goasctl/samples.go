@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/corona10/goimagehash"
+	"github.com/google/uuid"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/library"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/spf13/pflag"
+)
+
+const sampleQuality = 95
+
+func samplesFlags(name string) (*pflag.FlagSet, *bool, *string) {
+	fs, jsonOutput := newFlagSet(name)
+	dir := fs.StringP("samples", "s", "resources/samples", "Spam samples directory")
+	return fs, jsonOutput, dir
+}
+
+func samplesListCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("samples list")
+	_ = fs.Parse(args)
+
+	images, err := loadImages([]string{*dir})
+	if err != nil {
+		return err
+	}
+	if *jsonOutput {
+		return printJSON(images)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, img := range images {
+		fmt.Fprintf(w, "%s\t%s\n", filepath.Base(img.Path), img.Hex)
+	}
+	return w.Flush()
+}
+
+// samplesDedupeCommand removes samples within the threshold of an earlier sample.
+func samplesDedupeCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("samples dedupe")
+	threshold := fs.Int("threshold", 10, "Distance to consider samples duplicates")
+	dryRun := fs.Bool("dry-run", false, "Only print the duplicates")
+	_ = fs.Parse(args)
+
+	images, err := loadImages([]string{*dir})
+	if err != nil {
+		return err
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Path < images[j].Path
+	})
+
+	type duplicate struct {
+		Path     string `json:"path"`
+		Of       string `json:"of"`
+		Distance int    `json:"distance"`
+	}
+	var (
+		kept       []*hashedImage
+		duplicates []duplicate
+	)
+	for _, img := range images {
+		dup := false
+		for _, k := range kept {
+			dist, err := img.hash.Distance(k.hash)
+			if err != nil {
+				return fmt.Errorf("calculating distance: %w", err)
+			}
+			if dist <= *threshold {
+				duplicates = append(duplicates, duplicate{img.Path, k.Path, dist})
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			kept = append(kept, img)
+		}
+	}
+
+	if !*dryRun {
+		for _, d := range duplicates {
+			if err := os.Remove(d.Path); err != nil {
+				return fmt.Errorf("removing %s: %w", d.Path, err)
+			}
+		}
+	}
+
+	if *jsonOutput {
+		return printJSON(duplicates)
+	}
+	for _, d := range duplicates {
+		fmt.Printf("%s duplicates %s (distance %d)\n", d.Path, d.Of, d.Distance)
+	}
+	fmt.Printf("%d duplicates, %d samples kept\n", len(duplicates), len(kept))
+	return nil
+}
+
+// samplesPruneCommand removes the files that can't be loaded as samples,
+// and optionally the ones that didn't match anything for a while.
+func samplesPruneCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("samples prune")
+	dataDir := fs.StringP("data", "d", "data", "Data directory")
+	unusedMonths := fs.Int("unused-months", 0, "Also remove samples not matched for this many months")
+	dryRun := fs.Bool("dry-run", false, "Only print the samples to remove")
+	_ = fs.Parse(args)
+
+	files, err := expandPath(*dir)
+	if err != nil {
+		return err
+	}
+	broken := make([]string, 0)
+	for _, file := range files {
+		if _, err := imgmatch.LoadImage(file); err != nil {
+			broken = append(broken, file)
+			if *dryRun {
+				continue
+			}
+			if err := os.Remove(file); err != nil {
+				return fmt.Errorf("removing %s: %w", file, err)
+			}
+		}
+	}
+
+	stale := make([]library.Sample, 0)
+	if *unusedMonths > 0 {
+		s, closeStorage, err := openStorage(*dataDir)
+		if err != nil {
+			return err
+		}
+		defer closeStorage()
+
+		samples, err := listSamples(s, *dir)
+		if err != nil {
+			return err
+		}
+		stale = library.Stale(samples, time.Now().AddDate(0, -*unusedMonths, 0))
+		if !*dryRun {
+			for _, sample := range stale {
+				if err := library.Remove(*dir, sample.Name, s); err != nil {
+					return fmt.Errorf("removing %s: %w", sample.Name, err)
+				}
+			}
+		}
+	}
+
+	if *jsonOutput {
+		return printJSON(struct {
+			Broken []string         `json:"broken"`
+			Stale  []library.Sample `json:"stale"`
+		}{broken, stale})
+	}
+	for _, file := range broken {
+		fmt.Printf("%s is broken\n", file)
+	}
+	for _, sample := range stale {
+		fmt.Printf("%s last matched at %s\n", sample.Name, formatTime(sample.LastHit))
+	}
+	return nil
+}
+
+func samplesStatsCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("samples stats")
+	dataDir := fs.StringP("data", "d", "data", "Data directory")
+	top := fs.Int("top", 0, "Only show this many most matched samples")
+	unused := fs.Bool("unused", false, "Only show samples that never matched")
+	_ = fs.Parse(args)
+
+	s, closeStorage, err := openStorageReadOnly(*dataDir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	samples, err := listSamples(s, *dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *unused:
+		samples = library.Unused(samples)
+	case *top > 0:
+		samples = library.Top(samples, *top)
+	}
+
+	if *jsonOutput {
+		return printJSON(samples)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SAMPLE\tHITS\tLAST HIT\tADDED")
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", sample.Name, sample.Hits, formatTime(sample.LastHit), formatTime(sample.Added))
+	}
+	return w.Flush()
+}
+
+func samplesRemoveCommand(args []string) error {
+	fs, _, dir := samplesFlags("samples remove")
+	dataDir := fs.StringP("data", "d", "data", "Data directory")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: goasctl samples remove [flags] <id>...")
+	}
+
+	s, closeStorage, err := openStorage(*dataDir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	for _, id := range fs.Args() {
+		name, err := library.Resolve(*dir, id)
+		if err != nil {
+			return fmt.Errorf("finding sample: %w", err)
+		}
+		if err := library.Remove(*dir, name, s); err != nil {
+			return fmt.Errorf("removing %s: %w", name, err)
+		}
+		fmt.Printf("Removed %s\n", name)
+	}
+	return nil
+}
+
+// samplesClusterCommand groups near-duplicate samples, e.g. after changing the threshold.
+func samplesClusterCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("samples cluster")
+	threshold := fs.Int("threshold", 10, "Distance to consider samples duplicates")
+	_ = fs.Parse(args)
+
+	images, err := loadImages([]string{*dir})
+	if err != nil {
+		return err
+	}
+	hashes := make([]*goimagehash.ImageHash, 0, len(images))
+	for _, img := range images {
+		hashes = append(hashes, img.hash)
+	}
+	groups, err := imgmatch.Cluster(hashes, *threshold)
+	if err != nil {
+		return fmt.Errorf("clustering: %w", err)
+	}
+
+	clusters := make([][]string, 0)
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		cluster := make([]string, 0, len(group))
+		for _, i := range group {
+			cluster = append(cluster, filepath.Base(images[i].Path))
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	if *jsonOutput {
+		return printJSON(clusters)
+	}
+	for i, cluster := range clusters {
+		fmt.Printf("Cluster %d:\n", i+1)
+		for _, name := range cluster {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	fmt.Printf("%d clusters of near-duplicates\n", len(clusters))
+	return nil
+}
+
+func listSamples(s *storage.Storage, dir string) ([]library.Sample, error) {
+	stats, err := s.GetSampleStats()
+	if err != nil {
+		return nil, fmt.Errorf("getting sample stats: %w", err)
+	}
+	samples, err := library.List(dir, stats)
+	if err != nil {
+		return nil, fmt.Errorf("listing samples: %w", err)
+	}
+	return samples, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// samplesImportCommand adds the images that aren't close to the existing samples.
+func samplesImportCommand(args []string) error {
+	fs, jsonOutput, dir := samplesFlags("samples import")
+	threshold := fs.Int("threshold", 10, "Threshold to consider new sample interesting")
+	_ = fs.Parse(args)
+
+	m, err := imgmatch.NewMatcher(*dir, *threshold, 0)
+	if err != nil {
+		return fmt.Errorf("loading samples: %w", err)
+	}
+	images, err := loadImages(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	type imported struct {
+		Path   string `json:"path"`
+		Sample string `json:"sample,omitempty"`
+	}
+	result := make([]imported, 0, len(images))
+	for _, img := range images {
+		name := fmt.Sprintf("sample_%s.jpeg", uuid.New())
+		added, err := m.AddSample(name, img.img)
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", img.Path, err)
+		}
+		if !added {
+			result = append(result, imported{Path: img.Path})
+			continue
+		}
+		if err := saveJPEG(filepath.Join(*dir, name), img); err != nil {
+			return err
+		}
+		result = append(result, imported{Path: img.Path, Sample: name})
+	}
+
+	if *jsonOutput {
+		return printJSON(result)
+	}
+	for _, r := range result {
+		if r.Sample == "" {
+			fmt.Printf("%s skipped, close to an existing sample\n", r.Path)
+		} else {
+			fmt.Printf("%s imported as %s\n", r.Path, r.Sample)
+		}
+	}
+	return nil
+}
+
+func saveJPEG(path string, img *hashedImage) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	if err := jpeg.Encode(file, img.img, &jpeg.Options{Quality: sampleQuality}); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("encoding %s: %w", img.Path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/spf13/pflag"
+)
+
+func usersShowCommand(args []string) error {
+	return withUser("users show", args, openStorageReadOnly, nil, func(s *storage.Storage, userID int64, jsonOutput bool) error {
+		data, err := s.GetUserData(userID)
+		if err != nil {
+			return fmt.Errorf("getting user: %w", err)
+		}
+		trust, err := s.GetTrust(userID, 0)
+		if err != nil {
+			return fmt.Errorf("getting user trust: %w", err)
+		}
+		trusted := trust != nil && !trust.Revoked
+
+		if jsonOutput {
+			return printJSON(struct {
+				ID      int64             `json:"id"`
+				Admin   bool              `json:"admin"`
+				Trusted bool              `json:"trusted"`
+				Trust   *storage.Trust    `json:"trust,omitempty"`
+				Data    map[string]string `json:"data"`
+			}{userID, s.IsUserAdmin(userID), trusted, trust, data})
+		}
+
+		fmt.Printf("User %d, admin: %t, trusted everywhere: %t\n", userID, s.IsUserAdmin(userID), trusted)
+		if trust != nil {
+			fmt.Printf("Trust: %s at %s\n", trust.Reason, formatTime(trust.Time))
+		}
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", k, data[k])
+		}
+		return w.Flush()
+	})
+}
+
+func usersTrustCommand(args []string) error {
+	var chatID *int64
+	return withUser("users trust", args, openStorage, func(fs *pflag.FlagSet) {
+		chatID = fs.Int64("chat", 0, "Only trust the user in the chat")
+	}, func(s *storage.Storage, userID int64, _ bool) error {
+		if err := s.TrustUser(userID, *chatID, "trusted with goasctl"); err != nil {
+			return fmt.Errorf("trusting user: %w", err)
+		}
+		fmt.Printf("User %d is trusted\n", userID)
+		return nil
+	})
+}
+
+func usersUntrustCommand(args []string) error {
+	var chatID *int64
+	return withUser("users untrust", args, openStorage, func(fs *pflag.FlagSet) {
+		chatID = fs.Int64("chat", 0, "Only revoke the trust in the chat")
+	}, func(s *storage.Storage, userID int64, _ bool) error {
+		if err := s.UntrustUser(userID, *chatID, "revoked with goasctl"); err != nil {
+			return fmt.Errorf("untrusting user: %w", err)
+		}
+		fmt.Printf("User %d is not trusted\n", userID)
+		return nil
+	})
+}
+
+func usersTrustedCommand(args []string) error {
+	fs, jsonOutput, dir := dbFlags("users trusted")
+	chatID := fs.Int64("chat", 0, "Only show the users trusted in the chat")
+	offset := fs.Int("offset", 0, "Skip this many users")
+	limit := fs.Int("limit", 50, "Show this many users, 0 for all")
+	_ = fs.Parse(args)
+
+	s, closeStorage, err := openStorageReadOnly(*dir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	trusted, total, err := s.GetTrustedUsers(*chatID, *offset, *limit)
+	if err != nil {
+		return fmt.Errorf("getting trusted users: %w", err)
+	}
+	if *jsonOutput {
+		return printJSON(trusted)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tCHAT\tSINCE\tREASON")
+	for _, t := range trusted {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", t.UserID, t.ChatID, formatTime(t.Time), t.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("Showing %d of %d\n", len(trusted), total)
+	return nil
+}
+
+func withUser(
+	name string,
+	args []string,
+	open func(dir string) (*storage.Storage, func(), error),
+	flags func(fs *pflag.FlagSet),
+	fn func(s *storage.Storage, userID int64, jsonOutput bool) error,
+) error {
+	fs, jsonOutput, dir := dbFlags(name)
+	if flags != nil {
+		flags(fs)
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: goasctl %s [flags] <user id>", name)
+	}
+	userID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing user id: %w", err)
+	}
+
+	s, closeStorage, err := open(*dir)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	return fn(s, userID, *jsonOutput)
+}
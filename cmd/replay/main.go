@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+	"github.com/pomo-mondreganto/goas/internal/bot"
+	"github.com/pomo-mondreganto/goas/internal/bot/bottest"
+	"github.com/pomo-mondreganto/goas/internal/config"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/recorder"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// idleTimeout is how long the bot has to stay idle for the replay to be considered finished.
+const idleTimeout = 3 * time.Second
+
+var (
+	archive              = pflag.StringP("archive", "a", "archive.jsonl", "Recorded archive to replay")
+	samples              = pflag.StringP("samples", "s", "resources/samples", "Spam samples directory")
+	dictionary           = pflag.String("dictionary", "resources/banlist.txt", "Path to banned patterns text file")
+	interestingThreshold = pflag.Int("interesting_threshold", 10, "Threshold to consider new sample interesting")
+	suspiciousThreshold  = pflag.Int("suspicious_threshold", 15, "Threshold to consider an image suspicious")
+	logLevel             = pflag.String("log_level", "WARNING", "Bot log level")
+	jsonOutput           = pflag.Bool("json", false, "Print verdicts as JSON lines")
+)
+
+func main() {
+	pflag.Parse()
+	level, err := logrus.ParseLevel(*logLevel)
+	if err != nil {
+		logrus.Fatalf("Invalid log level: %v", err)
+	}
+	logrus.SetLevel(level)
+
+	srv := bottest.New(tgbotapi.User{ID: 1, IsBot: true, UserName: "goas_replay"})
+	defer srv.Close()
+
+	var updates []tgbotapi.Update
+	if err := recorder.Read(*archive, func(e recorder.Entry) error {
+		if e.Update != nil {
+			updates = append(updates, *e.Update)
+		}
+		if e.FileID != "" {
+			srv.AddFile(e.FileID, e.File)
+		}
+		return nil
+	}); err != nil {
+		logrus.Fatalf("Error reading archive: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "goas-replay")
+	if err != nil {
+		logrus.Fatalf("Error creating scratch directory: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logrus.Errorf("Error removing scratch directory: %v", err)
+		}
+	}()
+
+	// The bot learns samples and edits the dictionary and the allowlist, it does it to copies.
+	scratchSamples := filepath.Join(dir, "samples")
+	if err := copyDir(*samples, scratchSamples); err != nil {
+		logrus.Fatalf("Error copying samples: %v", err)
+	}
+	scratchDictionary := filepath.Join(dir, "banlist.txt")
+	if err := copyFile(*dictionary, scratchDictionary); err != nil {
+		logrus.Fatalf("Error copying dictionary: %v", err)
+	}
+
+	s, err := storage.New(dir)
+	if err != nil {
+		logrus.Fatalf("Error creating storage: %v", err)
+	}
+	l, err := banlist.New(scratchDictionary)
+	if err != nil {
+		logrus.Fatalf("Error creating dictionary: %v", err)
+	}
+	m, err := imgmatch.NewMatcher(scratchSamples, *interestingThreshold, *suspiciousThreshold)
+	if err != nil {
+		logrus.Fatalf("Error creating image matcher: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg := &config.Config{
+		Token:       "replay",
+		APIEndpoint: srv.Endpoint(),
+		HTTPClient:  srv.Client(),
+		Samples:     scratchSamples,
+		Dictionary:  scratchDictionary,
+	}
+	b, err := bot.New(ctx, cfg, s, l, m)
+	if err != nil {
+		logrus.Fatalf("Error creating bot: %v", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		verdicts []bot.Verdict
+	)
+	b.OnVerdict(func(v bot.Verdict) {
+		mu.Lock()
+		defer mu.Unlock()
+		verdicts = append(verdicts, v)
+		printVerdict(v)
+	})
+
+	for _, upd := range updates {
+		srv.PushUpdate(upd)
+	}
+	waitIdle(srv, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(verdicts)
+	})
+
+	cancel()
+	b.Wait()
+
+	if !*jsonOutput {
+		printSummary(srv, len(updates), verdicts)
+	}
+}
+
+// copyDir copies the directory tree, including the hidden files.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return fmt.Errorf("getting relative path: %w", err)
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("creating directory: %w", err)
+			}
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", src, err)
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", dst, err)
+	}
+	return nil
+}
+
+// waitIdle waits until neither verdicts nor outbound calls appear for a while.
+func waitIdle(srv *bottest.Server, verdictCount func() int) {
+	last := -1
+	lastChange := time.Now()
+	for time.Since(lastChange) < idleTimeout {
+		time.Sleep(100 * time.Millisecond)
+		if n := verdictCount() + len(srv.Calls("")); n != last {
+			last = n
+			lastChange = time.Now()
+		}
+	}
+}
+
+func printVerdict(v bot.Verdict) {
+	if *jsonOutput {
+		data, err := json.Marshal(v)
+		if err != nil {
+			logrus.Fatalf("Error serializing verdict: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Printf("chat %d\tmessages %v\tsender %s\t%s\n", v.ChatID, v.MessageIDs, v.Sender, v.Verdict)
+}
+
+func printSummary(srv *bottest.Server, updates int, verdicts []bot.Verdict) {
+	counts := make(map[string]int)
+	for _, v := range verdicts {
+		counts[v.Verdict]++
+	}
+	fmt.Printf("\nReplayed %d updates, checked %d messages\n", updates, len(verdicts))
+	for _, verdict := range []string{"not_spam", "might_be_spam", "definitely_spam"} {
+		fmt.Printf("  %s: %d\n", verdict, counts[verdict])
+	}
+	fmt.Println("Captured actions:")
+	for _, method := range []string{"sendMessage", "editMessageText", "deleteMessage", "banChatMember", "banChatSenderChat"} {
+		fmt.Printf("  %s: %d\n", method, len(srv.Calls(method)))
+	}
+}
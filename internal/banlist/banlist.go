@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -18,7 +19,7 @@ func New(path string) (*BanList, error) {
 	defer f.Close()
 	scanner := bufio.NewScanner(f)
 
-	l := BanList{}
+	l := BanList{path: path}
 	for scanner.Scan() {
 		if pattern := scanner.Text(); pattern != "" {
 			l.patterns = append(l.patterns, strings.ToLower(pattern))
@@ -32,11 +33,16 @@ func New(path string) (*BanList, error) {
 }
 
 type BanList struct {
+	path string
+
+	mu       sync.RWMutex
 	patterns []string
 }
 
 func (l *BanList) Contains(s string) bool {
 	s = strings.ToLower(s)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
 	for _, pattern := range l.patterns {
 		if strings.Contains(s, pattern) {
 			return true
@@ -44,3 +50,56 @@ func (l *BanList) Contains(s string) bool {
 	}
 	return false
 }
+
+// Matches returns all patterns found in the string.
+func (l *BanList) Matches(s string) []string {
+	s = strings.ToLower(s)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var result []string
+	for _, pattern := range l.patterns {
+		if strings.Contains(s, pattern) {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// Remove drops the pattern and rewrites the dictionary file.
+func (l *BanList) Remove(pattern string) (bool, error) {
+	pattern = strings.ToLower(pattern)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	patterns := make([]string, 0, len(l.patterns))
+	for _, p := range l.patterns {
+		if p != pattern {
+			patterns = append(patterns, p)
+		}
+	}
+	if len(patterns) == len(l.patterns) {
+		return false, nil
+	}
+
+	var sb strings.Builder
+	for _, p := range patterns {
+		sb.WriteString(p)
+		sb.WriteByte('\n')
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sb.String()), 0644); err != nil {
+		return false, fmt.Errorf("writing dictionary: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return false, fmt.Errorf("replacing dictionary: %w", err)
+	}
+	l.patterns = patterns
+	return true, nil
+}
+
+// Patterns returns the banned patterns.
+func (l *BanList) Patterns() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]string(nil), l.patterns...)
+}
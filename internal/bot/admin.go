@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/library"
+)
+
+const (
+	defaultSamplesListSize = 10
+	// maxListedSamples keeps the reply within the message size limit.
+	maxListedSamples = 50
+)
+
+// processPrivateCommand handles the admin commands sent to the bot directly.
+func (b *Bot) processPrivateCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.From == nil || !b.storage.IsUserAdmin(msg.From.ID) {
+		b.log(ctx).Warningf("Private command %s from non-admin", msg.Command())
+		return nil
+	}
+	b.log(ctx).Infof("Admin %d sent private command %s", msg.From.ID, msg.Command())
+
+	var (
+		reply string
+		err   error
+	)
+	switch msg.Command() {
+	case "samples":
+		reply, err = b.processSamplesCommand(strings.Fields(msg.CommandArguments()))
+	case "allowlist":
+		reply, err = b.processAllowlistCommand(ctx, msg, strings.Fields(msg.CommandArguments()))
+	default:
+		reply = "Unknown command"
+	}
+	if err != nil {
+		reply = fmt.Sprintf("Error: %v", err)
+	}
+	b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, reply))
+	return err
+}
+
+func (b *Bot) processSamplesCommand(args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: /samples {top [n]|unused|remove <id>|prune <months>}", nil
+	}
+
+	stats, err := b.storage.GetSampleStats()
+	if err != nil {
+		return "", fmt.Errorf("getting sample stats: %w", err)
+	}
+	samples, err := library.List(b.samplesPath, stats)
+	if err != nil {
+		return "", fmt.Errorf("listing samples: %w", err)
+	}
+
+	switch args[0] {
+	case "top":
+		n := defaultSamplesListSize
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil {
+				return "", fmt.Errorf("parsing count: %w", err)
+			}
+		}
+		return formatSamples("Top samples", library.Top(samples, n)), nil
+	case "unused":
+		return formatSamples("Samples that never matched", library.Unused(samples)), nil
+	case "remove":
+		if len(args) < 2 {
+			return "Usage: /samples remove <id>", nil
+		}
+		name, err := library.Resolve(b.samplesPath, args[1])
+		if err != nil {
+			return "", fmt.Errorf("finding sample: %w", err)
+		}
+		if err := b.removeSample(name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Removed %s", name), nil
+	case "prune":
+		if len(args) < 2 {
+			return "Usage: /samples prune <months>", nil
+		}
+		months, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", fmt.Errorf("parsing months: %w", err)
+		}
+		stale := library.Stale(samples, time.Now().AddDate(0, -months, 0))
+		for _, s := range stale {
+			if err := b.removeSample(s.Name); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("Removed %d samples not matched in %d months", len(stale), months), nil
+	default:
+		return "Unknown samples command", nil
+	}
+}
+
+// processAllowlistCommand manages the allowlist, images are added by replying to them.
+func (b *Bot) processAllowlistCommand(ctx context.Context, msg *tgbotapi.Message, args []string) (string, error) {
+	if len(args) == 0 {
+		return "Usage: /allowlist {list|add|remove <name>}", nil
+	}
+	switch args[0] {
+	case "list":
+		names := b.imgMatcher.Allowlist()
+		if len(names) == 0 {
+			return "Allowlist is empty", nil
+		}
+		return fmt.Sprintf("Allowlisted images (%d):\n%s", len(names), strings.Join(names, "\n")), nil
+	case "add":
+		if msg.ReplyToMessage == nil || len(msg.ReplyToMessage.Photo) == 0 {
+			return "Reply to a photo to allowlist it", nil
+		}
+		photo := msg.ReplyToMessage.Photo[len(msg.ReplyToMessage.Photo)-1]
+		img, err := b.downloadImg(ctx, photo.FileID, nil)
+		if err != nil {
+			return "", fmt.Errorf("downloading image: %w", err)
+		}
+		if err := b.imgMatcher.Allow(photo.FileUniqueID, img); err != nil {
+			return "", fmt.Errorf("allowlisting image: %w", err)
+		}
+		return fmt.Sprintf("Allowlisted %s", photo.FileUniqueID), nil
+	case "remove":
+		if len(args) < 2 {
+			return "Usage: /allowlist remove <name>", nil
+		}
+		removed, err := b.imgMatcher.Disallow(args[1])
+		if err != nil {
+			return "", fmt.Errorf("removing from allowlist: %w", err)
+		}
+		if !removed {
+			return fmt.Sprintf("%s is not allowlisted", args[1]), nil
+		}
+		return fmt.Sprintf("Removed %s from allowlist", args[1]), nil
+	default:
+		return "Unknown allowlist command", nil
+	}
+}
+
+func (b *Bot) removeSample(name string) error {
+	b.imgMatcher.RemoveSample(name)
+	if err := library.Remove(b.samplesPath, name, b.storage); err != nil {
+		return fmt.Errorf("removing sample %s: %w", name, err)
+	}
+	b.logger.Infof("Removed sample %s", name)
+	return nil
+}
+
+func formatSamples(title string, samples []library.Sample) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%d):\n", title, len(samples))
+	for i, s := range samples {
+		if i == maxListedSamples {
+			fmt.Fprintf(&sb, "...and %d more\n", len(samples)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "%s: %d hits", s.Name, s.Hits)
+		if !s.LastHit.IsZero() {
+			fmt.Fprintf(&sb, ", last %s", s.LastHit.Format("2006-01-02"))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// albumCollectTimeout is how long to wait for the rest of the media group
+// after its first message arrives.
+const albumCollectTimeout = 2 * time.Second
+
+// albumShutdownTimeout limits checking the albums collected when the bot stops.
+const albumShutdownTimeout = 10 * time.Second
+
+type album struct {
+	id       string
+	messages []*tgbotapi.Message
+}
+
+func (b *Bot) collectAlbumMessage(ctx context.Context, msg *tgbotapi.Message) {
+	key := albumKey(msg.Chat.ID, msg.MediaGroupID)
+
+	b.albumsMu.Lock()
+	defer b.albumsMu.Unlock()
+
+	if a, ok := b.pendingAlbums[key]; ok {
+		a.messages = append(a.messages, msg)
+		return
+	}
+
+	b.log(ctx).Debugf("Collecting album %s", msg.MediaGroupID)
+	b.pendingAlbums[key] = &album{
+		id:       msg.MediaGroupID,
+		messages: []*tgbotapi.Message{msg},
+	}
+	b.wg.Add(1)
+	go b.flushAlbum(ctx, key)
+}
+
+// flushAlbum hands the album over to its chat worker once it's collected. On shutdown
+// it's checked right away instead, since its updates are acknowledged already.
+func (b *Bot) flushAlbum(ctx context.Context, key string) {
+	defer b.wg.Done()
+
+	t := time.NewTimer(albumCollectTimeout)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+
+	b.albumsMu.Lock()
+	a := b.pendingAlbums[key]
+	delete(b.pendingAlbums, key)
+	b.albumsMu.Unlock()
+
+	sort.Slice(a.messages, func(i, j int) bool {
+		return a.messages[i].MessageID < a.messages[j].MessageID
+	})
+	if ctx.Err() == nil {
+		select {
+		case b.albums <- a:
+			return
+		case <-ctx.Done():
+		}
+	}
+
+	// The requests it makes are saved as dead letters, the dispatcher is stopped.
+	shutdownCtx := context.WithValue(context.Background(), correlationKey{}, correlationID(ctx))
+	shutdownCtx, cancel := context.WithTimeout(shutdownCtx, albumShutdownTimeout)
+	defer cancel()
+	b.log(shutdownCtx).Infof("Checking album %s on shutdown", a.id)
+	if err := b.processAlbum(shutdownCtx, a); err != nil {
+		b.log(shutdownCtx).Errorf("Error processing album: %v", err)
+	}
+}
+
+func albumKey(chatID int64, groupID string) string {
+	return fmt.Sprintf("%d:%s", chatID, groupID)
+}
@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestAlbumIsCheckedOnShutdown(t *testing.T) {
+	b, srv, stop := startStoppableTestBot(t)
+	verdicts := make(chan Verdict, 10)
+	b.OnVerdict(func(v Verdict) { verdicts <- v })
+	srv.AddFile("photo-1", encodeJPEG(t, image.NewGray(image.Rect(0, 0, 128, 128))))
+
+	for _, id := range []int{100, 101} {
+		msg := photoMessage(id, 54, "photo-1")
+		msg.MediaGroupID = "album"
+		runScript(srv, tgbotapi.Update{Message: msg})
+	}
+	deadline := time.Now().Add(callTimeout)
+	for {
+		collecting := 0
+		b.albumsMu.Lock()
+		if a, ok := b.pendingAlbums[albumKey(testChatID, "album")]; ok {
+			collecting = len(a.messages)
+		}
+		b.albumsMu.Unlock()
+		if collecting == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("collected %d album messages, expected 2", collecting)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	select {
+	case v := <-verdicts:
+		if len(v.MessageIDs) != 2 {
+			t.Fatalf("got verdict on messages %v, expected the album", v.MessageIDs)
+		}
+	default:
+		t.Fatal("album wasn't checked before the bot stopped")
+	}
+}
@@ -3,12 +3,16 @@ package bot
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
+	"github.com/pomo-mondreganto/goas/internal/storage"
 	"github.com/sirupsen/logrus"
-	"go.uber.org/atomic"
 )
 
 type spamVerdict int
@@ -19,175 +23,413 @@ const (
 	definitelySpam
 )
 
+func (v spamVerdict) String() string {
+	switch v {
+	case notSpam:
+		return "not_spam"
+	case mightBeSpam:
+		return "might_be_spam"
+	case definitelySpam:
+		return "definitely_spam"
+	}
+	return "unknown"
+}
+
 const (
-	trustAfterDays     = 30 * 6 // 6 months
-	trustAfterMessages = 10
+	detectorBanlist = "banlist"
+	detectorImages  = "imgmatch"
+	detectorForward = "forward"
+	detectorEdit    = "edit"
+)
+
+var detectors = []string{detectorBanlist, detectorImages, detectorForward, detectorEdit}
+
+// detection is the verdict with the reasons behind it.
+type detection struct {
+	detector string
+	verdict  spamVerdict
+	score    int
+	reason   string
+	patterns []string
+	samples  []string
+}
+
+func (d detection) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s, score %d (%s", d.detector, d.verdict, d.score, d.reason)
+	if len(d.patterns) > 0 {
+		fmt.Fprintf(&sb, ": %s", strings.Join(d.patterns, ", "))
+	}
+	if len(d.samples) > 0 {
+		fmt.Fprintf(&sb, ": %s", strings.Join(d.samples, ", "))
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
 
-	suspiciousForwardMsgThreshold = 3
-	suspiciousPhotoMsgThreshold   = 5
+// Verdict is the result of checking a message, or an album as a whole.
+type Verdict struct {
+	ChatID     int64  `json:"chat_id"`
+	MessageIDs []int  `json:"message_ids"`
+	Sender     string `json:"sender"`
+	Verdict    string `json:"verdict"`
+}
 
-	votesToBan = 3
+const (
+	banlistScore = 2 // for every pattern
+	imagesScore  = 10
+	forwardScore = 2
+	// A banned pattern in a link is suspicious whatever the sender's reputation.
+	banlistLinkScore = maxSpamThreshold
+
+	// Messages of a banned sender within the window are deleted along with the spam.
+	recentMessagesLimit  = 50
+	recentMessagesWindow = 24 * time.Hour
 )
 
-func (b *Bot) isChatMessageSuspicious(ctx context.Context, msg *tgbotapi.Message) (spamVerdict, error) {
-	authorID := msg.From.ID
+func (b *Bot) isChatMessageSuspicious(
+	ctx context.Context,
+	msgs []*tgbotapi.Message,
+	settings storage.ChatSettings,
+	edit *contentDiff,
+) (detection, error) {
+	msg := msgs[0]
+	from := resolveSender(msg)
+	authorID := from.id
 	chatID := msg.Chat.ID
 
-	logger := b.logger.WithField("authorID", authorID).WithField("chatID", chatID)
+	logger := b.log(ctx).WithField("sender", from.String()).WithField("chatID", chatID)
 	logger.Debugf("Checking message for spam")
 
-	if b.storage.IsUserAdmin(authorID) {
-		logger.Debug("Admin, not suspicious")
-		return notSpam, nil
+	if !from.isAccountable() {
+		logger.Debugf("Sent on behalf of %s, not suspicious", from.kind)
+		return detection{}, nil
 	}
-	trusted, err := b.storage.IsUserTrusted(authorID)
-	if err != nil {
-		return notSpam, fmt.Errorf("checking trusted: %w", err)
+	if b.storage.IsUserAdmin(authorID) {
+		logger.Debugf("Admin, not suspicious")
+		return detection{}, nil
 	}
-	if trusted {
-		logger.Debug("Trusted, not suspicious")
-		return notSpam, nil
+	reputation := 0
+	if from.kind == senderUser {
+		score, reason, err := b.reputation(authorID, chatID)
+		if err != nil {
+			return detection{}, err
+		}
+		logger.Debugf("Reputation %d: %s", score, reason)
+		reputation = score
 	}
+	threshold := spamThreshold(reputation)
 
-	now := time.Now()
-	firstSeen, err := b.storage.GetOrSetUserFirstSeen(authorID, now)
-	if err != nil {
-		return notSpam, fmt.Errorf("getting first seen: %w", err)
+	checks := []func() detection{
+		func() detection {
+			if patterns := b.checkMessage(ctx, msgs); len(patterns) > 0 {
+				logger.Debugf("Contains banned strings %v", patterns)
+				score, inLinks := banlistPatternsScore(msgs, patterns)
+				reason := "banned words"
+				if inLinks {
+					reason = "banned links"
+				}
+				return detection{
+					detector: detectorBanlist,
+					verdict:  mightBeSpam,
+					score:    score,
+					reason:   reason,
+					patterns: patterns,
+				}
+			}
+			return detection{}
+		},
+		func() detection {
+			if samples := b.checkPhoto(ctx, logger, msgs); len(samples) > 0 {
+				logger.Debugf("Photo matches spam samples %v", samples)
+				return detection{
+					detector: detectorImages,
+					verdict:  definitelySpam,
+					score:    imagesScore,
+					reason:   "spam image",
+					samples:  samples,
+				}
+			}
+			return detection{}
+		},
+		func() detection {
+			logger.Debugf(
+				"Forward info: from msg %d, user %s, chat %s at %v",
+				msg.ForwardFromMessageID,
+				b.redact.user(msg.ForwardFrom),
+				b.redact.chat(msg.ForwardFromChat),
+				msg.ForwardDate,
+			)
+			if checkForward(logger, msgs) {
+				return detection{detector: detectorForward, verdict: mightBeSpam, score: forwardScore, reason: "forward"}
+			}
+			return detection{}
+		},
+		func() detection {
+			if edit == nil || edit.empty() {
+				return detection{}
+			}
+			logger.Debugf("Edit added links %v, banned strings %v", b.redact.texts(edit.links), edit.patterns)
+			return detection{
+				detector: detectorEdit,
+				verdict:  mightBeSpam,
+				score:    editScore,
+				reason:   edit.reason(),
+				patterns: edit.patterns,
+			}
+		},
 	}
-	if firstSeen.Add(time.Hour * 24 * trustAfterDays).Before(now) {
-		logger.Debugf("Joined at %v, not suspicious", firstSeen)
-		return notSpam, nil
+	var hits []detection
+	for _, check := range checks {
+		d := check()
+		if d.verdict == notSpam {
+			continue
+		}
+		// Shadowed detectors are evaluated on live traffic without affecting the verdict.
+		if settings.IsDetectorShadowed(d.detector) {
+			metrics.DetectorHits.WithLabelValues(d.detector, "shadowed").Inc()
+			b.audit(ctx, settings, storage.AuditEntry{
+				ChatID:  chatID,
+				Action:  "detect",
+				Target:  from.String(),
+				Details: fmt.Sprintf("%s, threshold %d, message %d", d, threshold, msg.MessageID),
+				Shadow:  true,
+			}, auditContext{about: msg})
+			continue
+		}
+		hits = append(hits, d)
 	}
 
-	msgCount, err := b.storage.GetUserChatMessageCount(authorID, chatID)
-	if err != nil {
-		return notSpam, fmt.Errorf("getting message count: %w", err)
+	d := mergeDetections(hits)
+	if d.score < threshold {
+		// The score is kept, so that the message doesn't earn reputation.
+		logger.Debugf("Score %d is below threshold %d, not suspicious", d.score, threshold)
+		d.verdict = notSpam
 	}
-	if msgCount > trustAfterMessages {
-		logger.Debugf("Sent %d messages to chat, not suspicious", msgCount)
-		return notSpam, nil
+	for _, hit := range hits {
+		metrics.DetectorHits.WithLabelValues(hit.detector, d.verdict.String()).Inc()
 	}
-
-	logger.Debugf("Message count: %d", msgCount)
-
-	// Check message text.
-	if b.checkMessage(msg) {
-		logger.Debug("Contains banned string, suspicious")
-		return mightBeSpam, nil
-	}
-
-	logger.Debugf("Photos info: %v", msg.Photo)
-	if msgCount < suspiciousPhotoMsgThreshold && b.checkPhoto(ctx, logger, msg) {
-		logger.Debugf("Photo matches spam sample")
-		return definitelySpam, nil
+	if d.verdict == notSpam {
+		return d, nil
 	}
+	logger.Debugf("Score %d reaches threshold %d, suspicious", d.score, threshold)
+	return d, nil
+}
 
-	logger.Debugf(
-		"Forward info: from msg %d, user %v, chat %v at %v",
-		msg.ForwardFromMessageID,
-		msg.ForwardFrom,
-		msg.ForwardFromChat,
-		msg.ForwardDate,
+// mergeDetections sums up the hits, the verdict and the detector are the ones of the worst hit.
+func mergeDetections(hits []detection) detection {
+	var (
+		merged  detection
+		reasons []string
 	)
-	if msgCount < suspiciousForwardMsgThreshold && b.checkForward(logger, msg) {
-		logger.Debugf("Forward with only %d messages, suspicious", msgCount)
-		return mightBeSpam, nil
+	for _, d := range hits {
+		if d.verdict > merged.verdict {
+			merged.detector = d.detector
+			merged.verdict = d.verdict
+		}
+		merged.score += d.score
+		reasons = append(reasons, d.reason)
+		merged.patterns = append(merged.patterns, d.patterns...)
+		merged.samples = append(merged.samples, d.samples...)
 	}
-
-	logger.Debug("Checks passed, not suspicious")
-	return notSpam, nil
+	merged.reason = strings.Join(reasons, ", ")
+	merged.patterns = uniqueStrings(merged.patterns)
+	merged.samples = uniqueStrings(merged.samples)
+	return merged
 }
 
-func (b *Bot) checkForward(logger *logrus.Entry, msg *tgbotapi.Message) bool {
-	if msg.ForwardDate == 0 {
-		logger.Debug("Not a forward")
-		return false
+func checkForward(logger *logrus.Entry, msgs []*tgbotapi.Message) bool {
+	for _, msg := range msgs {
+		if msg.ForwardDate == 0 {
+			logger.Debug("Not a forward")
+			continue
+		}
+		if msg.ForwardFromChat != nil && msg.ForwardFromChat.ID == msg.Chat.ID {
+			logger.Debug("Same chat forward")
+			continue
+		}
+		return true
 	}
-	chatID := msg.Chat.ID
-	if msg.ForwardFromChat != nil && msg.ForwardFromChat.ID == chatID {
-		logger.Debug("Same chat forward")
-		return false
-	}
-	return true
+	return false
 }
 
-func (b *Bot) checkPhoto(ctx context.Context, logger *logrus.Entry, msg *tgbotapi.Message) bool {
-	if msg.Photo == nil {
+// checkPhoto returns the names of spam samples the photos match.
+func (b *Bot) checkPhoto(ctx context.Context, logger *logrus.Entry, msgs []*tgbotapi.Message) []string {
+	var fileIDs []string
+	for _, msg := range msgs {
+		logger.Debugf("Photos info: %v", msg.Photo)
+		for _, ps := range msg.Photo {
+			fileIDs = append(fileIDs, ps.FileID)
+		}
+	}
+	if len(fileIDs) == 0 {
 		logger.Debug("No photos")
-		return false
+		return nil
 	}
 
-	result := atomic.NewBool(false)
+	var (
+		mu      sync.Mutex
+		samples []string
+	)
 	wg := sync.WaitGroup{}
-	wg.Add(len(msg.Photo))
-	for _, ps := range msg.Photo {
+	wg.Add(len(fileIDs))
+	for _, fileID := range fileIDs {
 		go func(fileID string) {
 			defer wg.Done()
-			match, err := b.checkPhotoHashMatches(ctx, fileID)
+			sample, err := b.checkPhotoHashMatches(ctx, fileID)
 			if err != nil {
 				logger.Errorf("Error checking photo hash: %v", err)
 			}
-			if match {
-				result.Store(true)
+			if sample != "" {
+				mu.Lock()
+				samples = append(samples, sample)
+				mu.Unlock()
 			}
-		}(ps.FileID)
+		}(fileID)
 	}
 	wg.Wait()
 
-	return result.Load()
+	return uniqueStrings(samples)
 }
 
-func (b *Bot) checkMessage(msg *tgbotapi.Message) bool {
-	b.logger.Debugf("Checking message %v", msg.Text)
-	return b.banlist.Contains(msg.Text)
+// checkMessage returns the banned patterns found in the texts.
+func (b *Bot) checkMessage(ctx context.Context, msgs []*tgbotapi.Message) []string {
+	for _, msg := range msgs {
+		b.log(ctx).Debugf("Checking message %s", b.redact.text(msg.Text))
+	}
+	return matchBanlist(b.banlist, msgs)
 }
 
-func (b *Bot) checkPhotoHashMatches(ctx context.Context, fileID string) (bool, error) {
-	img, err := b.downloadImg(ctx, fileID, nil)
-	if err != nil {
-		return false, fmt.Errorf("downloading image: %w", err)
+// matchBanlist returns the banned patterns found in the texts and the captions.
+func matchBanlist(l *banlist.BanList, msgs []*tgbotapi.Message) []string {
+	var patterns []string
+	for _, msg := range msgs {
+		patterns = append(patterns, l.Matches(msg.Text)...)
+		patterns = append(patterns, l.Matches(msg.Caption)...)
 	}
-	suspicious, err := b.imgMatcher.CheckSample(img)
-	if err != nil {
-		return false, fmt.Errorf("checking image: %w", err)
-	}
-	return suspicious, nil
+	return uniqueStrings(patterns)
 }
 
-func (b *Bot) banSender(msg *tgbotapi.Message) {
-	userID := msg.From.ID
-	chatID := msg.Chat.ID
-	msgID := msg.MessageID
+// BaseSpamThreshold is the score at which a message of a sender without reputation is suspicious.
+const BaseSpamThreshold = baseSpamThreshold
 
-	if userID == b.api.Self.ID {
-		logrus.Warning("Trying to ban me")
-		return
+// TextScore scores the message the way the checks do, without the images,
+// so that the detectors can be evaluated outside of the bot.
+func TextScore(l *banlist.BanList, msg *tgbotapi.Message) int {
+	msgs := []*tgbotapi.Message{msg}
+	score := 0
+	if patterns := matchBanlist(l, msgs); len(patterns) > 0 {
+		patternsScore, _ := banlistPatternsScore(msgs, patterns)
+		score += patternsScore
+	}
+	if checkForward(logrus.NewEntry(logrus.StandardLogger()), msgs) {
+		score += forwardScore
 	}
+	return score
+}
 
-	if b.storage.IsUserAdmin(userID) {
-		logrus.Warning("Trying to ban admin")
-		return
+// banlistPatternsScore scores the banned patterns found in the messages,
+// the ones in their links score more, and tells if there were any.
+func banlistPatternsScore(msgs []*tgbotapi.Message, patterns []string) (int, bool) {
+	var links []string
+	for _, msg := range msgs {
+		links = append(links, messageLinks(msg)...)
 	}
+	score, inLinks := 0, false
+	for _, pattern := range patterns {
+		if containsSubstring(links, pattern) {
+			score += banlistLinkScore
+			inLinks = true
+		} else {
+			score += banlistScore
+		}
+	}
+	return score, inLinks
+}
 
-	b.logger.Infof("Deleting message %d from %d", msgID, userID)
-	b.requestDelete(chatID, msgID)
+func containsSubstring(values []string, s string) bool {
+	for _, v := range values {
+		if strings.Contains(v, s) {
+			return true
+		}
+	}
+	return false
+}
 
-	kickCfg := tgbotapi.KickChatMemberConfig{
-		ChatMemberConfig: tgbotapi.ChatMemberConfig{
-			ChatID: chatID,
-			UserID: userID,
-		},
+// checkPhotoHashMatches returns the name of the matched sample, if any.
+func (b *Bot) checkPhotoHashMatches(ctx context.Context, fileID string) (string, error) {
+	img, err := b.downloadImg(ctx, fileID, nil)
+	if err != nil {
+		return "", fmt.Errorf("downloading image: %w", err)
+	}
+	start := time.Now()
+	hash, err := imgmatch.Hash(img)
+	metrics.ImageHash.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return "", fmt.Errorf("hashing image: %w", err)
 	}
-	b.logger.Infof("Banning user %d", msg.From.ID)
-	b.requestSend(kickCfg)
+	sample, err := b.imgMatcher.MatchHash(hash)
+	if err != nil {
+		return "", fmt.Errorf("checking image: %w", err)
+	}
+	if sample == "" {
+		return "", nil
+	}
+	if err := b.storage.AddSampleHit(sample, time.Now()); err != nil {
+		b.log(ctx).Errorf("Error saving sample %s hit: %v", sample, err)
+	}
+	return sample, nil
+}
+
+// banSender bans the sender for good and deletes the message.
+func (b *Bot) banSender(ctx context.Context, msg *tgbotapi.Message) {
+	b.sanctionSender(ctx, msg, sanction{kind: sanctionBan}, 0, true)
 }
 
-func (b *Bot) checkVotes(votesFor, votesAgainst int, userID int64, userVote bool) (finish bool, verdict bool) {
+func (b *Bot) checkVotes(votesFor, votesAgainst, quorum int, userID int64, userVote bool) (finish bool, verdict bool) {
 	if b.storage.IsUserAdmin(userID) {
 		return true, userVote
 	}
-	if votesFor >= votesToBan || votesAgainst >= votesToBan {
+	if votesFor >= quorum || votesAgainst >= quorum {
 		return true, votesFor > votesAgainst
 	}
 	return false, false
 }
+
+// deleteRelatedMessages deletes the rest of the album
+// and the sender's recent messages in the chat.
+func (b *Bot) deleteRelatedMessages(ctx context.Context, from sender, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	seen := map[int]bool{msg.MessageID: true}
+	var toDelete []int
+
+	if msg.MediaGroupID != "" {
+		ids, err := b.storage.GetAlbumMessages(chatID, msg.MediaGroupID)
+		if err != nil {
+			b.log(ctx).Errorf("Error getting album %s messages: %v", msg.MediaGroupID, err)
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				toDelete = append(toDelete, id)
+			}
+		}
+	}
+
+	ids, err := b.storage.GetUserChatMessages(from.id, chatID, time.Now().Add(-recentMessagesWindow))
+	if err != nil {
+		b.log(ctx).Errorf("Error getting recent messages of %s: %v", from, err)
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			toDelete = append(toDelete, id)
+		}
+	}
+
+	if len(toDelete) == 0 {
+		return
+	}
+	b.log(ctx).Infof("Deleting %d more messages from %s", len(toDelete), from)
+	b.requestBulkDelete(ctx, chatID, toDelete)
+}
@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+)
+
+func TestTextScore(t *testing.T) {
+	dictionary := filepath.Join(t.TempDir(), "banlist.txt")
+	if err := os.WriteFile(dictionary, []byte("bitcoin\nt.me\n"), 0o644); err != nil {
+		t.Fatalf("writing dictionary: %v", err)
+	}
+	l, err := banlist.New(dictionary)
+	if err != nil {
+		t.Fatalf("creating dictionary: %v", err)
+	}
+
+	link := textMessage(2, 50, "join t.me/spam")
+	link.Entities = []tgbotapi.MessageEntity{{Type: "url", Offset: 5, Length: 9}}
+	forward := textMessage(3, 50, "hello")
+	forward.ForwardDate = 1
+	for _, tc := range []struct {
+		name string
+		msg  *tgbotapi.Message
+		want int
+	}{
+		{name: "clean", msg: textMessage(1, 50, "hello"), want: 0},
+		{name: "patterns", msg: textMessage(1, 50, "bitcoin is down, t.me is slow"), want: 2 * banlistScore},
+		{name: "link", msg: link, want: banlistLinkScore},
+		{name: "forward", msg: forward, want: forwardScore},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := TextScore(l, tc.msg); got != tc.want {
+				t.Fatalf("got score %d, expected %d", got, tc.want)
+			}
+		})
+	}
+}
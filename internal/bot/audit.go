@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+// contentCopyTimeout is how long the content waits to be copied to the log chat before it's deleted anyway.
+const contentCopyTimeout = 5 * time.Second
+
+// auditContext is what the log chat gets besides the audit entry.
+type auditContext struct {
+	// about is the message whose sender the entry is about.
+	about *tgbotapi.Message
+	// content is copied to the log chat before then is called, e.g. to delete it,
+	// then is called anyway if copying takes too long.
+	content *tgbotapi.Message
+	then    func()
+	undo    []tgbotapi.InlineKeyboardButton
+}
+
+// chatSettings returns the default settings if they can't be loaded,
+// so that a storage error doesn't stop the moderation.
+func (b *Bot) chatSettings(chatID int64) storage.ChatSettings {
+	settings, err := b.storage.GetChatSettings(chatID)
+	if err != nil {
+		b.logger.Errorf("Error getting chat %d settings: %v", chatID, err)
+	}
+	return settings
+}
+
+// perform runs the action unless the chat is in shadow mode, it's audited either way.
+func (b *Bot) perform(ctx context.Context, settings storage.ChatSettings, entry storage.AuditEntry, ac auditContext, action func()) {
+	entry.Shadow = settings.Shadow
+	b.audit(ctx, settings, entry, ac)
+	if !settings.Shadow {
+		action()
+	}
+}
+
+// audit records the action and mirrors it to the chat's log channel.
+func (b *Bot) audit(ctx context.Context, settings storage.ChatSettings, entry storage.AuditEntry, ac auditContext) {
+	entry.Time = time.Now()
+	b.log(ctx).WithField("chatID", entry.ChatID).Infof("Audit: %s", formatAuditEntry(entry))
+	if err := b.storage.AddAuditEntry(entry); err != nil {
+		b.log(ctx).Errorf("Error saving audit entry: %v", err)
+	}
+
+	then := func() {
+		if ac.then != nil {
+			ac.then()
+		}
+	}
+	if settings.LogChatID == 0 {
+		then()
+		return
+	}
+
+	m := tgbotapi.NewMessage(settings.LogChatID, formatLogMessage(entry, ac.about))
+	m.ParseMode = tgbotapi.ModeHTML
+	m.DisableWebPagePreview = true
+	if len(ac.undo) > 0 {
+		m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(ac.undo)
+	}
+	if ac.content == nil {
+		b.requestSendThen(ctx, m, func(*tgbotapi.Message) { then() })
+		return
+	}
+	// The content is copied in reply to the log message before it's deleted,
+	// but a slow log chat doesn't keep it in the chat for long.
+	copied := make(chan struct{})
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		t := time.NewTimer(contentCopyTimeout)
+		defer t.Stop()
+		select {
+		case <-copied:
+		case <-t.C:
+			b.log(ctx).Warningf("Content wasn't copied to log chat %d in %v", settings.LogChatID, contentCopyTimeout)
+		case <-ctx.Done():
+		}
+		then()
+	}()
+	b.requestSendThen(ctx, m, func(sent *tgbotapi.Message) {
+		c := tgbotapi.NewCopyMessage(settings.LogChatID, ac.content.Chat.ID, ac.content.MessageID)
+		if sent != nil {
+			c.ReplyToMessageID = sent.MessageID
+		}
+		b.requestSendThen(ctx, c, func(*tgbotapi.Message) { close(copied) })
+	})
+}
+
+func formatAuditEntry(entry storage.AuditEntry) string {
+	var sb strings.Builder
+	if entry.Shadow {
+		sb.WriteString("[shadow] ")
+	}
+	fmt.Fprintf(&sb, "chat %d: %s", entry.ChatID, entry.Action)
+	if entry.Target != "" {
+		fmt.Fprintf(&sb, " %s", entry.Target)
+	}
+	if entry.Details != "" {
+		fmt.Fprintf(&sb, ", %s", entry.Details)
+	}
+	return sb.String()
+}
+
+func formatLogMessage(entry storage.AuditEntry, about *tgbotapi.Message) string {
+	var sb strings.Builder
+	if entry.Shadow {
+		sb.WriteString("[shadow] ")
+	}
+	fmt.Fprintf(&sb, "<b>%s</b> in chat <code>%d</code>", html.EscapeString(entry.Action), entry.ChatID)
+	if about != nil && about.Chat != nil && about.Chat.Title != "" {
+		fmt.Fprintf(&sb, " (%s)", html.EscapeString(about.Chat.Title))
+	}
+	sb.WriteString("\n")
+	if about != nil {
+		fmt.Fprintf(&sb, "Sender: %s\n", senderLink(about))
+	} else if entry.Target != "" {
+		fmt.Fprintf(&sb, "Target: <code>%s</code>\n", html.EscapeString(entry.Target))
+	}
+	if entry.Details != "" {
+		fmt.Fprintf(&sb, "%s\n", html.EscapeString(entry.Details))
+	}
+	return sb.String()
+}
+
+// senderLink is an HTML link to the message sender.
+func senderLink(msg *tgbotapi.Message) string {
+	from := resolveSender(msg)
+	switch {
+	case msg.SenderChat != nil:
+		name := html.EscapeString(msg.SenderChat.Title)
+		if msg.SenderChat.UserName != "" {
+			name = fmt.Sprintf(`<a href="https://t.me/%s">%s</a>`, msg.SenderChat.UserName, name)
+		}
+		return fmt.Sprintf("%s (<code>%s</code>)", name, from)
+	case msg.From != nil:
+		name := strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)
+		if msg.From.UserName != "" {
+			name += " @" + msg.From.UserName
+		}
+		return fmt.Sprintf(
+			`<a href="tg://user?id=%d">%s</a> (<code>%s</code>)`,
+			msg.From.ID,
+			html.EscapeString(name),
+			from,
+		)
+	default:
+		return from.String()
+	}
+}
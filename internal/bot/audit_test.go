@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const testLogChatID = -1003000000003
+
+func spamAudit(ctx context.Context, b *Bot) {
+	spam := textMessage(10, 42, "spam")
+	b.audit(ctx, storage.ChatSettings{LogChatID: testLogChatID}, storage.AuditEntry{ChatID: testChatID, Action: sanctionBan}, auditContext{
+		about:   spam,
+		content: spam,
+		then:    func() { b.requestDelete(ctx, testChatID, spam.MessageID) },
+	})
+}
+
+func queuedDelete(b *Bot) bool {
+	for _, r := range b.requests.popAll() {
+		if _, ok := r.c.(tgbotapi.DeleteMessageConfig); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSpamIsDeletedWhenLogChatIsStuck(t *testing.T) {
+	b := newUnitBot(t)
+	// Nothing is delivered, so the log message is never sent and the content never copied.
+	spamAudit(context.Background(), b)
+
+	deadline := time.Now().Add(contentCopyTimeout + 5*time.Second)
+	for !queuedDelete(b) {
+		if time.Now().After(deadline) {
+			t.Fatal("spam wasn't deleted")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	b.wg.Wait()
+}
+
+func TestRequestsAfterShutdownAreDeadLettered(t *testing.T) {
+	b := newUnitBot(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	spamAudit(ctx, b)
+	b.requests.close()
+	cancel()
+	b.wg.Wait()
+
+	letters, err := b.storage.GetDeadLetters()
+	if err != nil {
+		t.Fatalf("getting dead letters: %v", err)
+	}
+	var deleted bool
+	for _, l := range letters {
+		if l.Request == "tgbotapi.DeleteMessageConfig" && l.Error == errDispatcherStopped.Error() {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Fatalf("got dead letters %v, expected the delete", letters)
+	}
+}
@@ -3,70 +3,162 @@ package bot
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 
 	"github.com/corona10/goimagehash"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pomo-mondreganto/goas/internal/banlist"
+	"github.com/pomo-mondreganto/goas/internal/config"
 	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
+	"github.com/pomo-mondreganto/goas/internal/recorder"
 	"github.com/pomo-mondreganto/goas/internal/storage"
 	"github.com/sirupsen/logrus"
 )
 
+const defaultAPIEndpoint = "https://api.telegram.org"
+
 func New(
 	ctx context.Context,
-	token string,
-	debug bool,
+	cfg *config.Config,
 	s *storage.Storage,
 	l *banlist.BanList,
 	m *imgmatch.Matcher,
 ) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(token)
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
+	client, transport := instrumentClient(client)
+	endpoint := strings.TrimSuffix(cfg.APIEndpoint, "/")
+	if endpoint == "" {
+		endpoint = defaultAPIEndpoint
+	}
+
+	api, err := tgbotapi.NewBotAPIWithClient(cfg.Token, endpoint+"/bot%s/%s", client)
 	if err != nil {
 		return nil, fmt.Errorf("creating bot api: %w", err)
 	}
-	if debug {
-		api.Debug = true
-	}
 	logger := logrus.WithField("account", api.Self.UserName)
 	logger.Infof("Authorized successfully")
+	if cfg.Debug {
+		// The API debug output has all the requests and responses as they are.
+		if cfg.LogRedactContent || cfg.LogRedactNames {
+			logger.Warning("API debug output is disabled, as logs are redacted")
+		} else {
+			api.Debug = true
+		}
+	}
+
+	var rec *recorder.Recorder
+	if cfg.Record != "" {
+		if rec, err = recorder.New(cfg.Record); err != nil {
+			return nil, fmt.Errorf("creating recorder: %w", err)
+		}
+		logger.Infof("Recording updates to %s", cfg.Record)
+	}
 
 	b := Bot{
-		api:        api,
-		requests:   make(chan tgbotapi.Chattable, 100),
-		updates:    make(chan tgbotapi.Update, 100),
-		logger:     logger,
-		storage:    s,
-		banlist:    l,
-		imgMatcher: m,
+		api:           api,
+		client:        client,
+		transport:     transport,
+		fileEndpoint:  endpoint + "/file/bot%s/%s",
+		requests:      newRequestQueue(),
+		updates:       make(chan tgbotapi.Update, 100),
+		albums:        make(chan *album, 10),
+		expiredVotes:  make(chan *storage.PendingVote),
+		memberCounts:  make(map[int64]memberCount),
+		refreshCounts: make(chan int64, 100),
+		shards:        make([]*eventQueue, eventWorkers),
+		pendingAlbums: make(map[string]*album),
+		logger:        logger,
+		storage:       s,
+		banlist:       l,
+		imgMatcher:    m,
+		recorder:      rec,
+		samplesPath:   cfg.Samples,
+		globalLimit:   newTokenBucket(globalRequestRate, globalRequestBurst),
+		chatLimits:    make(map[int64]*tokenBucket),
+		lanes:         make(map[int64]*requestLane),
+		redact:        redactor{content: cfg.LogRedactContent, names: cfg.LogRedactNames},
 	}
+	metrics.CountSamples(func() int { return len(m.Samples()) })
 
-	b.wg.Add(2)
+	b.wg.Add(5 + eventWorkers)
 	go b.setUpdatesPolling(ctx)
-	go b.processEvents(ctx)
+	go b.routeEvents(ctx)
+	go b.dispatchRequests(ctx)
+	go b.sweepVotes(ctx)
+	go b.refreshMemberCounts(ctx)
+	for i := range b.shards {
+		b.shards[i] = newEventQueue()
+		go b.processEvents(ctx, b.shards[i])
+	}
 
 	return &b, nil
 }
 
 type Bot struct {
-	api         *tgbotapi.BotAPI
-	updates     chan tgbotapi.Update
-	requests    chan tgbotapi.Chattable
-	logger      *logrus.Entry
-	wg          sync.WaitGroup
-	storage     *storage.Storage
-	banlist     *banlist.BanList
-	imgMatcher  *imgmatch.Matcher
-	spamSamples map[string]*goimagehash.ImageHash
-	samplesPath string
+	api          *tgbotapi.BotAPI
+	client       *http.Client
+	transport    *instrumentedTransport
+	fileEndpoint string
+	updates      chan tgbotapi.Update
+	requests     *requestQueue
+	albums       chan *album
+	expiredVotes chan *storage.PendingVote
+	shards       []*eventQueue
+	logger       *logrus.Entry
+	wg           sync.WaitGroup
+	storage      *storage.Storage
+	banlist      *banlist.BanList
+	imgMatcher   *imgmatch.Matcher
+	recorder     *recorder.Recorder
+	onVerdict    func(Verdict)
+	spamSamples  map[string]*goimagehash.ImageHash
+	samplesPath  string
+
+	albumsMu      sync.Mutex
+	pendingAlbums map[string]*album
+
+	memberCountsMu sync.Mutex
+	memberCounts   map[int64]memberCount
+	// refreshCounts gets the chats whose member counts are to be refreshed.
+	refreshCounts chan int64
+
+	globalLimit  *tokenBucket
+	chatLimitsMu sync.Mutex
+	chatLimits   map[int64]*tokenBucket
+
+	lanesMu sync.Mutex
+	lanes   map[int64]*requestLane
+
+	redact redactor
 }
 
 func (b *Bot) Wait() {
 	b.wg.Wait()
+	if b.recorder != nil {
+		if err := b.recorder.Close(); err != nil {
+			b.logger.Errorf("Error closing recorder: %v", err)
+		}
+	}
 	b.logger.Infof("Shutdown complete")
 }
 
+// UserName returns the bot's username.
+func (b *Bot) UserName() string {
+	return b.api.Self.UserName
+}
+
+// OnVerdict sets the function called with the verdict for every checked message.
+// It must be set before any updates arrive.
+func (b *Bot) OnVerdict(fn func(Verdict)) {
+	b.onVerdict = fn
+}
+
 func (b *Bot) setUpdatesPolling(ctx context.Context) {
 	defer b.wg.Done()
 
@@ -81,82 +173,143 @@ loop:
 		case <-ctx.Done():
 			break loop
 		case upd := <-updatesChan:
-			b.updates <- upd
+			if b.recorder != nil {
+				if err := b.recorder.RecordUpdate(upd); err != nil {
+					b.log(ctx).Errorf("Error recording update: %v", err)
+				}
+			}
+			select {
+			case b.updates <- upd:
+			case <-ctx.Done():
+				break loop
+			}
 		}
 	}
 }
 
-func (b *Bot) processEvents(ctx context.Context) {
+func (b *Bot) routeEvents(ctx context.Context) {
 	defer b.wg.Done()
 
-loop:
 	for {
-		b.logger.Debug("Waiting for events")
+		var e *event
 		select {
 		case upd := <-b.updates:
-			if upd.CallbackQuery != nil {
-				if err := b.processCallback(ctx, upd.CallbackQuery); err != nil {
-					b.logger.Errorf("Error processing callback: %v", err)
-				}
-				break
-			}
+			e = &event{update: &upd}
+		case a := <-b.albums:
+			e = &event{album: a}
+		case v := <-b.expiredVotes:
+			e = &event{expiredVote: v}
+		case <-ctx.Done():
+			b.log(ctx).Info("Context cancelled, exiting")
+			return
+		}
+		b.shards[e.shard(len(b.shards))].push(e)
+	}
+}
 
-			b.logger.Infof("Received an update: %v", upd)
+func (b *Bot) processEvents(ctx context.Context, events *eventQueue) {
+	defer b.wg.Done()
 
-			if upd.Message != nil && upd.Message.Chat != nil && !upd.Message.Chat.IsPrivate() {
-				if upd.Message.NewChatMembers != nil {
-					if err := b.processNewMembersMessage(upd.Message); err != nil {
-						b.logger.Errorf("Error processing new members: %v", err)
-					}
-					break
-				}
-				if upd.Message.LeftChatMember != nil {
-					b.processMemberLeftMessage(upd.Message)
-					break
-				}
-				if err := b.processChatMessage(ctx, upd.Message); err != nil {
-					b.logger.Errorf("Error processing chat message: %v", err)
-					break
-				}
-			}
-			if upd.EditedMessage != nil && upd.EditedMessage.Chat != nil && !upd.EditedMessage.Chat.IsPrivate() {
-				if err := b.processChatMessage(ctx, upd.EditedMessage); err != nil {
-					b.logger.Errorf("Error processing edited chat message: %v", err)
-					break
+	for {
+		b.log(ctx).Debug("Waiting for events")
+		select {
+		case <-events.ready:
+			for _, e := range events.popAll() {
+				if ctx.Err() != nil {
+					return
 				}
+				b.processEvent(withCorrelationID(ctx), e)
 			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-		case m := <-b.requests:
-			b.logger.Debugf("Received a request: %#v", m)
+func (b *Bot) processEvent(ctx context.Context, e *event) {
+	switch {
+	case e.album != nil:
+		if err := b.processAlbum(ctx, e.album); err != nil {
+			b.log(ctx).Errorf("Error processing album: %v", err)
+		}
+	case e.expiredVote != nil:
+		if err := b.processExpiredVote(ctx, e.expiredVote); err != nil {
+			b.log(ctx).Errorf("Error processing expired vote: %v", err)
+		}
+	default:
+		b.processUpdate(ctx, e.update)
+	}
+}
 
-			var err error
-			switch m.(type) {
-			case tgbotapi.EditMessageTextConfig:
-				if _, err = b.api.Send(m); err != nil && strings.Contains(err.Error(), "not modified") {
-					err = nil
-				}
-			case tgbotapi.DeleteMessageConfig, tgbotapi.KickChatMemberConfig:
-				_, err = b.api.Request(m)
-			default:
-				_, err = b.api.Send(m)
-			}
+func (b *Bot) processUpdate(ctx context.Context, upd *tgbotapi.Update) {
+	metrics.Updates.WithLabelValues(updateType(upd)).Inc()
+	b.log(ctx).WithFields(updateFields(upd)).Info("Received an update")
+	if !b.redact.content && !b.redact.names {
+		b.log(ctx).Debugf("Update: %+v", upd)
+	}
+	if upd.CallbackQuery != nil && strings.HasPrefix(upd.CallbackQuery.Data, logCallbackPrefix) {
+		if err := b.processLogCallback(ctx, upd.CallbackQuery); err != nil {
+			b.log(ctx).Errorf("Error processing log callback: %v", err)
+		}
+		return
+	}
+	if upd.CallbackQuery != nil {
+		if err := b.processCallback(ctx, upd.CallbackQuery); err != nil {
+			b.log(ctx).Errorf("Error processing callback: %v", err)
+		}
+		return
+	}
 
-			if err != nil {
-				b.logger.Errorf("Error sending request: %v", err)
-				break
-			}
+	if upd.Message != nil && upd.Message.Chat != nil && upd.Message.Chat.IsPrivate() && upd.Message.IsCommand() {
+		if err := b.processPrivateCommand(ctx, upd.Message); err != nil {
+			b.log(ctx).Errorf("Error processing private command: %v", err)
+		}
+		return
+	}
 
-		case <-ctx.Done():
-			b.logger.Info("Context cancelled, exiting")
-			break loop
+	if upd.Message != nil && upd.Message.Chat != nil && !upd.Message.Chat.IsPrivate() {
+		if upd.Message.NewChatMembers != nil {
+			if err := b.processNewMembersMessage(ctx, upd.Message); err != nil {
+				b.log(ctx).Errorf("Error processing new members: %v", err)
+			}
+			return
+		}
+		if upd.Message.LeftChatMember != nil {
+			b.processMemberLeftMessage(ctx, upd.Message)
+			return
+		}
+		if err := b.processChatMessage(ctx, upd.Message); err != nil {
+			b.log(ctx).Errorf("Error processing chat message: %v", err)
+			return
 		}
 	}
+	if upd.EditedMessage != nil && upd.EditedMessage.Chat != nil && !upd.EditedMessage.Chat.IsPrivate() {
+		if err := b.processEditedMessage(ctx, upd.EditedMessage); err != nil {
+			b.log(ctx).Errorf("Error processing edited chat message: %v", err)
+		}
+	}
+}
+
+func (b *Bot) requestSend(ctx context.Context, msg tgbotapi.Chattable) {
+	b.requestSendThen(ctx, msg, nil)
 }
 
-func (b *Bot) requestSend(msg tgbotapi.Chattable) {
-	b.requests <- msg
+// requestSendThen calls onDone once the request is done, with the sent message if it succeeded.
+// Requests made after the dispatcher has stopped are saved as dead letters.
+func (b *Bot) requestSendThen(ctx context.Context, msg tgbotapi.Chattable, onDone func(sent *tgbotapi.Message)) {
+	r := &outboundRequest{c: msg, correlationID: correlationID(ctx), onDone: onDone}
+	if !b.requests.push(r) {
+		b.recordDeadLetter(r, errDispatcherStopped)
+	}
+}
+
+func (b *Bot) requestDelete(ctx context.Context, chatID int64, messageID int) {
+	b.requestSend(ctx, tgbotapi.DeleteMessageConfig{ChatID: chatID, MessageID: messageID})
 }
 
-func (b *Bot) requestDelete(chatID int64, messageID int) {
-	b.requests <- tgbotapi.DeleteMessageConfig{ChatID: chatID, MessageID: messageID}
+// requestBulkDelete queues the deletions, the dispatcher keeps them within rate limits.
+func (b *Bot) requestBulkDelete(ctx context.Context, chatID int64, messageIDs []int) {
+	for _, id := range messageIDs {
+		b.requestDelete(ctx, chatID, id)
+	}
 }
@@ -0,0 +1,271 @@
+// Package bottest implements an in-process fake Telegram Bot API server for the bot's
+// end-to-end tests, it's also used to replay recorded updates without network access.
+package bottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pollTimeout limits long polling, so that shutdown is quick.
+const pollTimeout = time.Second
+
+// Call is a recorded Bot API method call.
+type Call struct {
+	Method string
+	Params url.Values
+	// MessageID is the ID of the message the call sent or edited.
+	MessageID int
+}
+
+func New(self tgbotapi.User) *Server {
+	s := &Server{
+		self:          self,
+		files:         make(map[string][]byte),
+		notify:        make(chan struct{}),
+		nextMessageID: 1_000_000,
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+type Server struct {
+	srv  *httptest.Server
+	self tgbotapi.User
+
+	mu            sync.Mutex
+	updates       []tgbotapi.Update
+	calls         []Call
+	files         map[string][]byte
+	notify        chan struct{}
+	nextUpdateID  int
+	nextMessageID int
+	permissions   *tgbotapi.ChatPermissions
+}
+
+// Endpoint returns the server URL to be used as the bot's api endpoint.
+func (s *Server) Endpoint() string {
+	return s.srv.URL
+}
+
+func (s *Server) Client() *http.Client {
+	return s.srv.Client()
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// PushUpdate queues the update for getUpdates, update id is assigned automatically.
+func (s *Server) PushUpdate(upd tgbotapi.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextUpdateID++
+	upd.UpdateID = s.nextUpdateID
+	s.updates = append(s.updates, upd)
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// AddFile makes the file downloadable by its id.
+func (s *Server) AddFile(fileID string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileID] = data
+}
+
+// SetChatPermissions sets the default member permissions getChat returns.
+func (s *Server) SetChatPermissions(p tgbotapi.ChatPermissions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissions = &p
+}
+
+// Calls returns the recorded calls of the method, or all calls if method is empty.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// WaitCalls waits until the method is called at least n times.
+func (s *Server) WaitCalls(method string, n int, timeout time.Duration) ([]Call, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		calls := s.Calls(method)
+		if len(calls) >= n {
+			return calls, nil
+		}
+		if time.Now().After(deadline) {
+			return calls, fmt.Errorf("got %d calls of %s, expected %d", len(calls), method, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// WaitCall waits until the method is called with the params, and returns the first such call.
+func (s *Server) WaitCall(method string, params map[string]string, timeout time.Duration) (Call, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, c := range s.Calls(method) {
+			if hasParams(c.Params, params) {
+				return c, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return Call{}, fmt.Errorf("%s wasn't called with %v", method, params)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func hasParams(values url.Values, params map[string]string) bool {
+	for k, v := range params {
+		if values.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) == 3 && parts[0] == "file" {
+		s.serveFile(w, r, parts[2])
+		return
+	}
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	method := parts[1]
+	if method == "getUpdates" {
+		s.getUpdates(w, r)
+		return
+	}
+
+	call := Call{Method: method, Params: r.PostForm}
+	var result interface{}
+	switch method {
+	case "getMe":
+		result = s.self
+	case "getFile":
+		fileID := r.PostForm.Get("file_id")
+		result = tgbotapi.File{FileID: fileID, FilePath: fileID}
+	case "sendMessage", "editMessageText":
+		msg := s.message(r.PostForm)
+		call.MessageID = msg.MessageID
+		result = msg
+	case "getChat":
+		chatID, _ := strconv.ParseInt(r.PostForm.Get("chat_id"), 10, 64)
+		s.mu.Lock()
+		result = tgbotapi.Chat{ID: chatID, Type: "supergroup", Permissions: s.permissions}
+		s.mu.Unlock()
+	case "getChatMembersCount", "getChatMemberCount":
+		result = 100
+	default:
+		result = true
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	s.mu.Unlock()
+	respond(w, result)
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.PostForm.Get("offset"))
+
+	s.mu.Lock()
+	pending := s.pendingUpdates(offset)
+	notify := s.notify
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		select {
+		case <-notify:
+		case <-time.After(pollTimeout):
+		case <-r.Context().Done():
+		}
+		s.mu.Lock()
+		pending = s.pendingUpdates(offset)
+		s.mu.Unlock()
+	}
+	respond(w, pending)
+}
+
+func (s *Server) pendingUpdates(offset int) []tgbotapi.Update {
+	pending := make([]tgbotapi.Update, 0)
+	for _, upd := range s.updates {
+		if upd.UpdateID >= offset {
+			pending = append(pending, upd)
+		}
+	}
+	return pending
+}
+
+func (s *Server) message(params url.Values) tgbotapi.Message {
+	chatID, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	messageID, _ := strconv.Atoi(params.Get("message_id"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if messageID == 0 {
+		s.nextMessageID++
+		messageID = s.nextMessageID
+	}
+	return tgbotapi.Message{
+		MessageID: messageID,
+		From:      &s.self,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "supergroup"},
+		Text:      params.Get("text"),
+	}
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	s.mu.Lock()
+	data, ok := s.files[path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func respond(w http.ResponseWriter, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func respondError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description})
+}
@@ -0,0 +1,312 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Telegram allows about 30 requests per second in total
+	// and 20 messages per minute to the same group.
+	globalRequestRate  = 30
+	globalRequestBurst = 30
+	chatMessageRate    = 20.0 / 60
+	chatMessageBurst   = 20
+
+	maxRequestAttempts = 5
+	retryBaseDelay     = time.Second
+	retryMaxDelay      = time.Minute
+)
+
+var errDispatcherStopped = errors.New("dispatcher stopped")
+
+type outboundRequest struct {
+	c             tgbotapi.Chattable
+	attempts      int
+	correlationID string
+	// onDone is called once the request is delivered or given up on,
+	// with the sent message if the request produced one.
+	onDone func(sent *tgbotapi.Message)
+}
+
+func (r *outboundRequest) done(sent *tgbotapi.Message) {
+	metrics.QueueDepth.Dec()
+	if r.onDone != nil {
+		r.onDone(sent)
+	}
+}
+
+func (b *Bot) dispatchRequests(ctx context.Context) {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case <-b.requests.ready:
+			for _, r := range b.requests.popAll() {
+				if b.redact.content || b.redact.names {
+					b.requestLog(r).Debugf("Received a request %T", r.c)
+				} else {
+					b.requestLog(r).Debugf("Received a request: %#v", r.c)
+				}
+				b.enqueueRequest(ctx, r)
+			}
+		case <-ctx.Done():
+			for _, r := range b.requests.close() {
+				b.recordDeadLetter(r, ctx.Err())
+			}
+			return
+		}
+	}
+}
+
+// requestLane is the queue of the requests to a chat. They are delivered one by one,
+// so that e.g. the edits of a message are applied in order.
+type requestLane struct {
+	requests []*outboundRequest
+}
+
+// enqueueRequest appends the request to its chat's lane, starting the lane if it's idle.
+func (b *Bot) enqueueRequest(ctx context.Context, r *outboundRequest) {
+	chatID := requestChatID(r.c)
+
+	b.lanesMu.Lock()
+	defer b.lanesMu.Unlock()
+	lane, ok := b.lanes[chatID]
+	if !ok {
+		lane = &requestLane{}
+		b.lanes[chatID] = lane
+		b.wg.Add(1)
+		go b.runLane(ctx, chatID, lane)
+	}
+	lane.requests = append(lane.requests, r)
+}
+
+// runLane delivers the requests of the lane until it's empty.
+func (b *Bot) runLane(ctx context.Context, chatID int64, lane *requestLane) {
+	defer b.wg.Done()
+
+	for {
+		b.lanesMu.Lock()
+		if len(lane.requests) == 0 {
+			delete(b.lanes, chatID)
+			b.lanesMu.Unlock()
+			return
+		}
+		r := lane.requests[0]
+		lane.requests = lane.requests[1:]
+		b.lanesMu.Unlock()
+
+		b.deliverRequest(ctx, r)
+	}
+}
+
+// requestChatID returns the chat the request is to, or 0 if it's not to a chat.
+func requestChatID(c tgbotapi.Chattable) int64 {
+	switch r := c.(type) {
+	case tgbotapi.MessageConfig:
+		return r.ChatID
+	case tgbotapi.PhotoConfig:
+		return r.ChatID
+	case tgbotapi.CopyMessageConfig:
+		return r.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return r.ChatID
+	case tgbotapi.DeleteMessageConfig:
+		return r.ChatID
+	case tgbotapi.KickChatMemberConfig:
+		return r.ChatID
+	case tgbotapi.RestrictChatMemberConfig:
+		return r.ChatID
+	case tgbotapi.UnbanChatMemberConfig:
+		return r.ChatID
+	case tgbotapi.BanChatSenderChatConfig:
+		return r.ChatID
+	case tgbotapi.UnbanChatSenderChatConfig:
+		return r.ChatID
+	default:
+		return 0
+	}
+}
+
+// deliverRequest sends the request respecting rate limits and retries it until it
+// either succeeds or fails permanently, in which case it's saved as a dead letter.
+func (b *Bot) deliverRequest(ctx context.Context, r *outboundRequest) {
+	if err := ctx.Err(); err != nil {
+		b.recordDeadLetter(r, err)
+		return
+	}
+
+	delay := time.Duration(0)
+	for {
+		delay += b.reserveRequest(r.c)
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				b.recordDeadLetter(r, ctx.Err())
+				return
+			}
+		}
+
+		r.attempts++
+		sent, err := b.sendRequest(r)
+		if err == nil {
+			b.requestLog(r).Debugf("Sent request %T (attempt %d)", r.c, r.attempts)
+			if sent.MessageID != 0 {
+				r.done(&sent)
+			} else {
+				r.done(nil)
+			}
+			return
+		}
+
+		retry, canRetry := retryDelay(r.c, err, r.attempts)
+		if !canRetry || r.attempts >= maxRequestAttempts {
+			b.requestLog(r).Errorf("Error sending request: %v", err)
+			b.recordDeadLetter(r, err)
+			return
+		}
+		b.requestLog(r).Warningf("Error sending request (attempt %d), retrying in %v: %v", r.attempts, retry, err)
+		delay = retry
+	}
+}
+
+func (b *Bot) sendRequest(r *outboundRequest) (tgbotapi.Message, error) {
+	c := r.c
+	var (
+		sent tgbotapi.Message
+		err  error
+	)
+	switch c.(type) {
+	case tgbotapi.MessageConfig, tgbotapi.EditMessageTextConfig:
+		sent, err = b.api.Send(c)
+	default:
+		_, err = b.api.Request(c)
+	}
+	if err == nil {
+		return sent, nil
+	}
+	if isBenignError(err) {
+		b.requestLog(r).Debugf("Ignoring error: %v", err)
+		return sent, nil
+	}
+	return sent, fmt.Errorf("sending %T: %w", c, err)
+}
+
+func (b *Bot) reserveRequest(c tgbotapi.Chattable) time.Duration {
+	now := time.Now()
+	wait := b.globalLimit.reserve(now)
+
+	if chatID, ok := chatMessageTarget(c); ok {
+		b.chatLimitsMu.Lock()
+		limit, ok := b.chatLimits[chatID]
+		if !ok {
+			limit = newTokenBucket(chatMessageRate, chatMessageBurst)
+			b.chatLimits[chatID] = limit
+		}
+		b.chatLimitsMu.Unlock()
+
+		if chatWait := limit.reserve(now); chatWait > wait {
+			wait = chatWait
+		}
+	}
+	return wait
+}
+
+// chatMessageTarget returns the chat the request posts or edits a message in,
+// these count towards the chat's message limit.
+func chatMessageTarget(c tgbotapi.Chattable) (int64, bool) {
+	switch c.(type) {
+	case tgbotapi.MessageConfig, tgbotapi.PhotoConfig, tgbotapi.CopyMessageConfig, tgbotapi.EditMessageTextConfig:
+		return requestChatID(c), true
+	default:
+		return 0, false
+	}
+}
+
+// requestLog returns the logger with the correlation ID of the event the request results from.
+func (b *Bot) requestLog(r *outboundRequest) *logrus.Entry {
+	return withCorrelationField(b.logger, r.correlationID)
+}
+
+func (b *Bot) recordDeadLetter(r *outboundRequest, reason error) {
+	metrics.ActionFailures.WithLabelValues(requestAction(r.c)).Inc()
+	payload, err := json.Marshal(r.c)
+	if err != nil {
+		b.requestLog(r).Errorf("Error serializing dead letter %T: %v", r.c, err)
+	}
+	letter := storage.DeadLetter{
+		Time:     time.Now(),
+		Request:  fmt.Sprintf("%T", r.c),
+		Payload:  payload,
+		Error:    reason.Error(),
+		Attempts: r.attempts,
+	}
+	b.requestLog(r).Errorf("Request %s failed permanently after %d attempts: %v", letter.Request, r.attempts, reason)
+	if err := b.storage.AddDeadLetter(letter); err != nil {
+		b.requestLog(r).Errorf("Error saving dead letter: %v", err)
+	}
+	r.done(nil)
+}
+
+// retryDelay tells if the failed request can be retried and when.
+func retryDelay(c tgbotapi.Chattable, err error, attempt int) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.RetryAfter > 0 {
+			return time.Duration(apiErr.RetryAfter) * time.Second, true
+		}
+		if apiErr.Code == http.StatusTooManyRequests {
+			return backoff(attempt), true
+		}
+		if apiErr.Code >= http.StatusInternalServerError && isIdempotent(c) {
+			return backoff(attempt), true
+		}
+		return 0, false
+	}
+	// Network errors, the request might have been executed.
+	if isIdempotent(c) {
+		return backoff(attempt), true
+	}
+	return 0, false
+}
+
+func backoff(attempt int) time.Duration {
+	d := retryBaseDelay << (attempt - 1)
+	if d <= 0 || d > retryMaxDelay {
+		return retryMaxDelay
+	}
+	return d
+}
+
+func isIdempotent(c tgbotapi.Chattable) bool {
+	switch c.(type) {
+	case tgbotapi.DeleteMessageConfig,
+		tgbotapi.KickChatMemberConfig,
+		tgbotapi.BanChatSenderChatConfig,
+		tgbotapi.UnbanChatMemberConfig,
+		tgbotapi.UnbanChatSenderChatConfig,
+		tgbotapi.RestrictChatMemberConfig,
+		tgbotapi.EditMessageTextConfig:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBenignError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "not modified") || strings.Contains(msg, "message to delete not found")
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRequestsToChatKeepOrder(t *testing.T) {
+	b, srv := startTestBot(t)
+	ctx := context.Background()
+
+	chats := []int64{testChatID, testChatID - 1, testChatID - 2}
+	const edits = 10
+	for i := 1; i <= edits; i++ {
+		for _, chatID := range chats {
+			b.requestSend(ctx, tgbotapi.NewEditMessageText(chatID, 100, strconv.Itoa(i)))
+		}
+	}
+
+	calls, err := srv.WaitCalls("editMessageText", edits*len(chats), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := make(map[string]int)
+	for _, c := range calls {
+		chatID := c.Params.Get("chat_id")
+		n, _ := strconv.Atoi(c.Params.Get("text"))
+		if n != last[chatID]+1 {
+			t.Fatalf("chat %s got edit %d after %d", chatID, n, last[chatID])
+		}
+		last[chatID] = n
+	}
+}
+
+func TestChatMessageLimitCoversAllMessages(t *testing.T) {
+	for _, c := range []tgbotapi.Chattable{
+		tgbotapi.NewMessage(testChatID, "text"),
+		tgbotapi.NewPhoto(testChatID, tgbotapi.FileID("photo")),
+		tgbotapi.NewCopyMessage(testChatID, testChatID-1, 1),
+		tgbotapi.NewEditMessageText(testChatID, 1, "text"),
+	} {
+		t.Run(fmt.Sprintf("%T", c), func(t *testing.T) {
+			b := &Bot{
+				globalLimit: newTokenBucket(globalRequestRate, globalRequestBurst),
+				chatLimits:  make(map[int64]*tokenBucket),
+			}
+			for i := 0; i < chatMessageBurst; i++ {
+				if wait := b.reserveRequest(c); wait > 0 {
+					t.Fatalf("request %d waits %v within the burst", i+1, wait)
+				}
+			}
+			if wait := b.reserveRequest(c); wait == 0 {
+				t.Fatal("the chat's message limit isn't applied")
+			}
+			if wait := b.reserveRequest(tgbotapi.NewDeleteMessage(testChatID, 1)); wait > 0 {
+				t.Fatalf("delete waits %v for the message limit", wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/bot/bottest"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const callTimeout = 10 * time.Second
+
+// The tests run scripts of updates the bot gets from getUpdates,
+// and check the calls it makes in response.
+
+func testChat() *tgbotapi.Chat {
+	return &tgbotapi.Chat{ID: testChatID, Type: "supergroup", Title: "test"}
+}
+
+func textMessage(messageID int, userID int64, text string) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: userID, FirstName: "user" + strconv.FormatInt(userID, 10)},
+		Chat:      testChat(),
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+}
+
+func commandMessage(messageID int, userID int64, command string, reply *tgbotapi.Message) *tgbotapi.Message {
+	msg := textMessage(messageID, userID, "/"+command)
+	msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command) + 1}}
+	msg.ReplyToMessage = reply
+	return msg
+}
+
+func photoMessage(messageID int, userID int64, fileID string) *tgbotapi.Message {
+	msg := textMessage(messageID, userID, "")
+	msg.Photo = []tgbotapi.PhotoSize{{FileID: fileID, FileUniqueID: fileID, Width: 128, Height: 128}}
+	return msg
+}
+
+func voteCallback(id string, userID int64, promptID int, about *tgbotapi.Message, data string) *tgbotapi.CallbackQuery {
+	return &tgbotapi.CallbackQuery{
+		ID:   id,
+		From: &tgbotapi.User{ID: userID},
+		Message: &tgbotapi.Message{
+			MessageID:      promptID,
+			Chat:           testChat(),
+			ReplyToMessage: about,
+		},
+		Data: data,
+	}
+}
+
+func runScript(srv *bottest.Server, script ...tgbotapi.Update) {
+	for _, upd := range script {
+		srv.PushUpdate(upd)
+	}
+}
+
+func waitCall(t *testing.T, srv *bottest.Server, method string, params map[string]string) bottest.Call {
+	t.Helper()
+	c, err := srv.WaitCall(method, params, callTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func chatParams(params map[string]string) map[string]string {
+	params["chat_id"] = strconv.FormatInt(testChatID, 10)
+	return params
+}
+
+// testImage is unlike a blank one, so that it makes an interesting sample.
+func testImage() image.Image {
+	img := image.NewGray(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x/16 + y/32) % 2 * 255)})
+		}
+	}
+	return img
+}
+
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+	return encodeJPEG(t, testImage())
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("encoding image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVoteBansSpammer(t *testing.T) {
+	_, srv := startTestBot(t)
+
+	spam := textMessage(10, 42, "cheap bitcoin at t.me/spam")
+	runScript(srv, tgbotapi.Update{Message: spam})
+	prompt := waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "10"}))
+
+	runScript(srv, tgbotapi.Update{CallbackQuery: voteCallback("1", testAdminID, prompt.MessageID, spam, voteSpamCallback)})
+	waitCall(t, srv, "banChatMember", chatParams(map[string]string{"user_id": "42"}))
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": "10"}))
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": strconv.Itoa(prompt.MessageID)}))
+}
+
+func TestSpamCommandLearnsSample(t *testing.T) {
+	b, srv := startTestBot(t)
+	img := testJPEG(t)
+	srv.AddFile("photo-1", img)
+	srv.AddFile("photo-2", img)
+
+	photo := photoMessage(20, 43, "photo-1")
+	runScript(srv,
+		tgbotapi.Update{Message: photo},
+		tgbotapi.Update{Message: commandMessage(21, testAdminID, "spam", photo)},
+	)
+	waitCall(t, srv, "banChatMember", chatParams(map[string]string{"user_id": "43"}))
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": "20"}))
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": "21"}))
+
+	samples := b.imgMatcher.Samples()
+	if len(samples) != 1 {
+		t.Fatalf("got samples %v, expected one learned sample", samples)
+	}
+	if _, err := os.Stat(filepath.Join(b.samplesPath, samples[0])); err != nil {
+		t.Fatalf("sample file: %v", err)
+	}
+
+	// The same image from someone else is spam now.
+	repost := photoMessage(30, 44, "photo-2")
+	runScript(srv, tgbotapi.Update{Message: repost})
+	prompt := waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "30"}))
+	runScript(srv, tgbotapi.Update{CallbackQuery: voteCallback("2", testAdminID, prompt.MessageID, repost, voteSpamCallback)})
+	waitCall(t, srv, "banChatMember", chatParams(map[string]string{"user_id": "44"}))
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": "30"}))
+}
+
+func TestBanDeletesRecentMessages(t *testing.T) {
+	_, srv := startTestBot(t)
+
+	first := textMessage(40, 45, "hi")
+	runScript(srv,
+		tgbotapi.Update{Message: first},
+		tgbotapi.Update{Message: textMessage(41, 45, "how are you")},
+		tgbotapi.Update{Message: textMessage(42, 46, "someone else")},
+		tgbotapi.Update{Message: commandMessage(43, testAdminID, "ban", first)},
+	)
+	waitCall(t, srv, "banChatMember", chatParams(map[string]string{"user_id": "45"}))
+	for _, id := range []string{"40", "41", "43"} {
+		waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": id}))
+	}
+	for _, c := range srv.Calls("deleteMessage") {
+		if c.Params.Get("message_id") == "42" {
+			t.Fatal("deleted a message of someone else")
+		}
+	}
+}
+
+func TestTrustedVoterDoesNotDecideAlone(t *testing.T) {
+	b, srv := startTestBot(t)
+	const trusted, reputable = 50, 51
+	if err := b.storage.TrustUser(trusted, testChatID, "test"); err != nil {
+		t.Fatalf("trusting user: %v", err)
+	}
+	if err := b.storage.SeedReputation(testChatID, reputable, storage.Reputation{CleanDays: reputableReputation}); err != nil {
+		t.Fatalf("seeding reputation: %v", err)
+	}
+
+	spam := textMessage(50, 47, "cheap bitcoin at t.me/spam")
+	runScript(srv, tgbotapi.Update{Message: spam})
+	prompt := waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "50"}))
+	promptID := strconv.Itoa(prompt.MessageID)
+
+	runScript(srv, tgbotapi.Update{CallbackQuery: voteCallback("3", trusted, prompt.MessageID, spam, voteSpamCallback)})
+	waitCall(t, srv, "editMessageText", chatParams(map[string]string{"message_id": promptID}))
+	if calls := srv.Calls("banChatMember"); len(calls) > 0 {
+		t.Fatalf("a single voter banned the sender: %v", calls)
+	}
+
+	runScript(srv, tgbotapi.Update{CallbackQuery: voteCallback("4", reputable, prompt.MessageID, spam, voteSpamCallback)})
+	waitCall(t, srv, "banChatMember", chatParams(map[string]string{"user_id": "47"}))
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": "50"}))
+}
+
+func TestBannedLinkFromTrustedMember(t *testing.T) {
+	b, srv := startTestBot(t)
+	verdicts := make(chan Verdict, 10)
+	b.OnVerdict(func(v Verdict) { verdicts <- v })
+	const trusted = 52
+	if err := b.storage.TrustUser(trusted, testChatID, "test"); err != nil {
+		t.Fatalf("trusting user: %v", err)
+	}
+
+	// A couple of banned words aren't enough for a trusted member.
+	runScript(srv, tgbotapi.Update{Message: textMessage(80, trusted, "bitcoin is down, t.me is slow")})
+	select {
+	case v := <-verdicts:
+		if v.Verdict != notSpam.String() {
+			t.Fatalf("got verdict %s for banned words, expected %s", v.Verdict, notSpam)
+		}
+	case <-time.After(callTimeout):
+		t.Fatal("message wasn't checked")
+	}
+
+	link := textMessage(81, trusted, "join t.me/spam")
+	link.Entities = []tgbotapi.MessageEntity{{Type: "url", Offset: 5, Length: 9}}
+	runScript(srv, tgbotapi.Update{Message: link})
+	waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "81"}))
+}
+
+func TestEditReplacingPhotoIsChecked(t *testing.T) {
+	b, srv := startTestBot(t)
+	if _, err := b.imgMatcher.AddSample("spam.jpg", testImage()); err != nil {
+		t.Fatalf("adding sample: %v", err)
+	}
+	blank := image.NewGray(image.Rect(0, 0, 128, 128))
+	srv.AddFile("photo-clean", encodeJPEG(t, blank))
+	srv.AddFile("photo-spam", testJPEG(t))
+
+	photo := photoMessage(90, 53, "photo-clean")
+	photo.Caption = "my cat"
+	runScript(srv, tgbotapi.Update{Message: photo})
+
+	// Only the photo is replaced, the caption stays the same.
+	edited := photoMessage(90, 53, "photo-spam")
+	edited.Caption = "my cat"
+	runScript(srv, tgbotapi.Update{EditedMessage: edited})
+	waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "90"}))
+}
+
+func TestReportOfVotedMessageReusesPrompt(t *testing.T) {
+	b, srv := startTestBot(t)
+	for _, id := range []int64{61, 62} {
+		if err := b.storage.TrustUser(id, testChatID, "test"); err != nil {
+			t.Fatalf("trusting user: %v", err)
+		}
+	}
+
+	spam := textMessage(100, 60, "cheap bitcoin at t.me/spam")
+	runScript(srv, tgbotapi.Update{Message: spam})
+	prompt := waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "100"}))
+	deadline := time.Now().Add(callTimeout)
+	for {
+		promptID, err := b.storage.GetVotePrompt(testChatID, spam.MessageID)
+		if err != nil {
+			t.Fatalf("getting vote prompt: %v", err)
+		}
+		if promptID != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("vote prompt wasn't saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	restrictions := len(srv.Calls("restrictChatMember"))
+
+	runScript(srv,
+		tgbotapi.Update{Message: commandMessage(101, 61, "report", spam)},
+		tgbotapi.Update{Message: commandMessage(102, 62, "report", spam)},
+	)
+	edit := waitCall(t, srv, "editMessageText", chatParams(map[string]string{"message_id": strconv.Itoa(prompt.MessageID)}))
+	if !strings.Contains(edit.Params.Get("text"), "reported by 2 members") {
+		t.Fatalf("got prompt %q, expected it to mention the reports", edit.Params.Get("text"))
+	}
+	if prompts := srv.Calls("sendMessage"); len(prompts) != 1 {
+		t.Fatalf("got %d messages sent, expected the single prompt", len(prompts))
+	}
+	if n := len(srv.Calls("restrictChatMember")); n != restrictions {
+		t.Fatalf("got %d restrictions, expected %d", n, restrictions)
+	}
+	r, _, err := b.storage.GetReputation(testChatID, 60)
+	if err != nil {
+		t.Fatalf("getting reputation: %v", err)
+	}
+	if r.Reports != 0 {
+		t.Fatalf("got %d reports in reputation before the vote, expected none", r.Reports)
+	}
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const (
+	// Adding a link or a banned word by an edit is suspicious whatever the sender's reputation.
+	editScore = maxSpamThreshold
+
+	// Edits of older messages are checked without comparing them to the original.
+	fingerprintTTL = 7 * 24 * time.Hour
+)
+
+// contentDiff is what an edit added to the message.
+type contentDiff struct {
+	links    []string
+	patterns []string
+}
+
+func (d contentDiff) empty() bool {
+	return len(d.links) == 0 && len(d.patterns) == 0
+}
+
+func (d contentDiff) reason() string {
+	var added []string
+	if len(d.links) > 0 {
+		added = append(added, "links")
+	}
+	if len(d.patterns) > 0 {
+		added = append(added, "banned words")
+	}
+	return "edit added " + strings.Join(added, " and ")
+}
+
+func (b *Bot) fingerprint(ctx context.Context, msg *tgbotapi.Message) storage.Fingerprint {
+	content := append([]string{msg.Text, msg.Caption}, mediaIDs(msg)...)
+	hash := sha256.Sum256([]byte(strings.Join(content, "\x00")))
+	return storage.Fingerprint{
+		Time:     msg.Time(),
+		Hash:     hex.EncodeToString(hash[:16]),
+		Links:    messageLinks(msg),
+		Patterns: b.checkMessage(ctx, []*tgbotapi.Message{msg}),
+	}
+}
+
+// mediaIDs returns the unique IDs of the message's files, they change when the media is replaced.
+func mediaIDs(msg *tgbotapi.Message) []string {
+	var ids []string
+	for _, ps := range msg.Photo {
+		ids = append(ids, ps.FileUniqueID)
+	}
+	if msg.Document != nil {
+		ids = append(ids, msg.Document.FileUniqueID)
+	}
+	if msg.Video != nil {
+		ids = append(ids, msg.Video.FileUniqueID)
+	}
+	if msg.Animation != nil {
+		ids = append(ids, msg.Animation.FileUniqueID)
+	}
+	return ids
+}
+
+// messageLinks returns the links Telegram found in the text and the caption.
+func messageLinks(msg *tgbotapi.Message) []string {
+	var links []string
+	collect := func(text string, entities []tgbotapi.MessageEntity) {
+		for _, e := range entities {
+			switch e.Type {
+			case "url":
+				links = append(links, strings.ToLower(entityText(text, e)))
+			case "text_link":
+				links = append(links, strings.ToLower(e.URL))
+			}
+		}
+	}
+	collect(msg.Text, msg.Entities)
+	collect(msg.Caption, msg.CaptionEntities)
+	return uniqueStrings(links)
+}
+
+// entityText cuts the entity out of the text, its offsets are in UTF-16 code units.
+func entityText(text string, e tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if e.Offset < 0 || e.Length < 0 || e.Offset+e.Length > len(units) {
+		return ""
+	}
+	return string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+}
+
+func diffFingerprints(old, current storage.Fingerprint) contentDiff {
+	return contentDiff{
+		links:    subtractStrings(current.Links, old.Links),
+		patterns: subtractStrings(current.Patterns, old.Patterns),
+	}
+}
+
+func subtractStrings(values, remove []string) []string {
+	var result []string
+	for _, v := range values {
+		if !contains(remove, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func (b *Bot) rememberFingerprint(ctx context.Context, msg *tgbotapi.Message) {
+	if err := b.storage.SetFingerprint(msg.Chat.ID, msg.MessageID, b.fingerprint(ctx, msg)); err != nil {
+		b.log(ctx).Errorf("Error saving fingerprint of message %d: %v", msg.MessageID, err)
+	}
+}
+
+// processEditedMessage checks the edited message again, it's not counted as a new one.
+// What the edit added is compared with the original, if it's still remembered.
+func (b *Bot) processEditedMessage(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.IsCommand() {
+		return nil
+	}
+	old, err := b.storage.GetFingerprint(msg.Chat.ID, msg.MessageID)
+	if err != nil {
+		return fmt.Errorf("getting fingerprint: %w", err)
+	}
+	current := b.fingerprint(ctx, msg)
+	if old != nil && old.Hash == current.Hash {
+		b.log(ctx).Debugf("Message %d edited without changing the content", msg.MessageID)
+		return nil
+	}
+	if err := b.storage.SetFingerprint(msg.Chat.ID, msg.MessageID, current); err != nil {
+		return fmt.Errorf("saving fingerprint: %w", err)
+	}
+
+	diff := &contentDiff{}
+	if old != nil {
+		*diff = diffFingerprints(*old, current)
+	}
+	b.log(ctx).Infof("Message %d edited, added links %v, banned words %v", msg.MessageID, b.redact.texts(diff.links), diff.patterns)
+	return b.checkChatMessages(ctx, []*tgbotapi.Message{msg}, diff)
+}
+
+// updateVotePrompt reuses the pending vote on the edited message, it returns false if there's none.
+func (b *Bot) updateVotePrompt(ctx context.Context, msg *tgbotapi.Message, d detection) (bool, error) {
+	chatID := msg.Chat.ID
+	pending, err := b.pendingVoteOn(chatID, msg.MessageID)
+	if err != nil || pending == nil {
+		return false, err
+	}
+
+	// The vote is on the message as it's now.
+	if pending.Message, err = json.Marshal(msg); err != nil {
+		return false, fmt.Errorf("serializing voted message: %w", err)
+	}
+	if err := b.storage.AddPendingVote(*pending); err != nil {
+		return false, fmt.Errorf("saving pending vote: %w", err)
+	}
+	if err := b.editVotePrompt(ctx, chatID, pending.PromptID, fmt.Sprintf("The message was edited (%s).", d.reason)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// pendingVoteOn returns the pending vote on the message, or nil if there's none.
+func (b *Bot) pendingVoteOn(chatID int64, messageID int) (*storage.PendingVote, error) {
+	promptID, err := b.storage.GetVotePrompt(chatID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("getting vote prompt: %w", err)
+	}
+	if promptID == 0 {
+		return nil, nil
+	}
+	pending, err := b.storage.GetPendingVote(chatID, promptID)
+	if err != nil {
+		return nil, fmt.Errorf("getting pending vote: %w", err)
+	}
+	return pending, nil
+}
+
+// editVotePrompt tells the voters why the message is brought up again, keeping the tally.
+func (b *Bot) editVotePrompt(ctx context.Context, chatID int64, promptID int, why string) error {
+	votesFor, votesAgainst, err := b.storage.GetVotes(chatID, promptID)
+	if err != nil {
+		return fmt.Errorf("getting votes: %w", err)
+	}
+	b.requestSend(ctx, tgbotapi.EditMessageTextConfig{
+		BaseEdit: tgbotapi.BaseEdit{
+			ChatID:      chatID,
+			MessageID:   promptID,
+			ReplyMarkup: getSpamVoteMarkup(),
+		},
+		Text:      fmt.Sprintf("%s Is it spam?\n\n%s", why, formatVoteTally(votesFor, votesAgainst, b.voteQuorum(chatID))),
+		ParseMode: "markdown",
+	})
+	return nil
+}
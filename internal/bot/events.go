@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+// eventWorkers is the number of goroutines processing events. Events of a chat
+// always go to the same worker, so they are processed in order.
+const eventWorkers = 8
+
+type event struct {
+	update      *tgbotapi.Update
+	album       *album
+	expiredVote *storage.PendingVote
+}
+
+func (e *event) chatID() int64 {
+	switch {
+	case e.album != nil:
+		return e.album.messages[0].Chat.ID
+	case e.expiredVote != nil:
+		return e.expiredVote.ChatID
+	case e.update.Message != nil && e.update.Message.Chat != nil:
+		return e.update.Message.Chat.ID
+	case e.update.EditedMessage != nil && e.update.EditedMessage.Chat != nil:
+		return e.update.EditedMessage.Chat.ID
+	case e.update.CallbackQuery != nil && e.update.CallbackQuery.Message != nil &&
+		e.update.CallbackQuery.Message.Chat != nil:
+		return e.update.CallbackQuery.Message.Chat.ID
+	default:
+		return 0
+	}
+}
+
+func (e *event) shard(n int) int {
+	id := e.chatID()
+	if id < 0 {
+		id = -id
+	}
+	return int(id % int64(n))
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{ready: make(chan struct{}, 1)}
+}
+
+// eventQueue is an unbounded queue of the events of a worker,
+// so that a worker stuck on a slow chat doesn't hold up routing for the others.
+type eventQueue struct {
+	mu    sync.Mutex
+	items []*event
+	ready chan struct{}
+}
+
+func (q *eventQueue) push(e *event) {
+	q.mu.Lock()
+	q.items = append(q.items, e)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// popAll returns the queued events in order and empties the queue.
+func (q *eventQueue) popAll() []*event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = nil
+	return items
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/bot/bottest"
+)
+
+// verdictLog collects the verdicts in the order they are given.
+type verdictLog struct {
+	mu       sync.Mutex
+	verdicts map[int64][]int
+	changed  chan struct{}
+}
+
+func newVerdictLog() *verdictLog {
+	return &verdictLog{verdicts: make(map[int64][]int), changed: make(chan struct{}, 1)}
+}
+
+func (l *verdictLog) add(v Verdict) {
+	l.mu.Lock()
+	l.verdicts[v.ChatID] = append(l.verdicts[v.ChatID], v.MessageIDs...)
+	l.mu.Unlock()
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+}
+
+// wait returns the message IDs of the chat once there are n of them.
+func (l *verdictLog) wait(t *testing.T, chatID int64, n int, timeout time.Duration) []int {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		l.mu.Lock()
+		ids := append([]int(nil), l.verdicts[chatID]...)
+		l.mu.Unlock()
+		if len(ids) >= n {
+			return ids
+		}
+		select {
+		case <-l.changed:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("got %d verdicts in chat %d, expected %d", len(ids), chatID, n)
+		}
+	}
+}
+
+func pushChatMessage(srv *bottest.Server, chatID int64, messageID int) {
+	srv.PushUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: 1000 + int64(messageID), FirstName: "user"},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "supergroup"},
+		Date:      int(time.Now().Unix()),
+		Text:      fmt.Sprintf("hello %d", messageID),
+	}})
+}
+
+func assertOrdered(t *testing.T, chatID int64, ids []int) {
+	t.Helper()
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("chat %d: message %d processed after %d", chatID, ids[i], ids[i-1])
+		}
+	}
+}
+
+func TestEventsOfChatKeepOrder(t *testing.T) {
+	b, srv := startTestBot(t)
+	log := newVerdictLog()
+	b.OnVerdict(log.add)
+
+	chats := []int64{testChatID, testChatID - 1, testChatID - 2, testChatID - 3}
+	const messages = 150
+	for i := 1; i <= messages; i++ {
+		for _, chatID := range chats {
+			pushChatMessage(srv, chatID, i)
+		}
+	}
+	for _, chatID := range chats {
+		assertOrdered(t, chatID, log.wait(t, chatID, messages, 30*time.Second))
+	}
+}
+
+func TestSlowChatDoesNotStallOthers(t *testing.T) {
+	b, srv := startTestBot(t)
+	log := newVerdictLog()
+	slowChat, fastChat := int64(testChatID), int64(testChatID-1)
+
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	var once, releaseOnce sync.Once
+	unblock := func() { releaseOnce.Do(func() { close(release) }) }
+	// The bot can't stop while the verdict is blocked.
+	t.Cleanup(unblock)
+	b.OnVerdict(func(v Verdict) {
+		if v.ChatID == slowChat {
+			once.Do(func() { close(blocked) })
+			<-release
+		}
+		log.add(v)
+	})
+
+	pushChatMessage(srv, slowChat, 1)
+	select {
+	case <-blocked:
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow chat wasn't processed")
+	}
+	// More than any fixed buffer would take.
+	const backlog = 500
+	for i := 2; i <= backlog; i++ {
+		pushChatMessage(srv, slowChat, i)
+	}
+	for i := 1; i <= 10; i++ {
+		pushChatMessage(srv, fastChat, i)
+	}
+	fast := log.wait(t, fastChat, 10, 10*time.Second)
+	unblock()
+
+	assertOrdered(t, fastChat, fast)
+	assertOrdered(t, slowChat, log.wait(t, slowChat, backlog, 30*time.Second))
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+	"github.com/pomo-mondreganto/goas/internal/bot/bottest"
+	"github.com/pomo-mondreganto/goas/internal/config"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// startTestBot runs the bot against a fake Bot API until the test ends.
+func startTestBot(t *testing.T) (*Bot, *bottest.Server) {
+	t.Helper()
+	b, srv, _ := startStoppableTestBot(t)
+	return b, srv
+}
+
+// startStoppableTestBot also returns the function that stops the bot before the test ends.
+func startStoppableTestBot(t *testing.T) (*Bot, *bottest.Server, func()) {
+	t.Helper()
+	srv := bottest.New(tgbotapi.User{ID: 1, IsBot: true, UserName: "goas_bot"})
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	samples := filepath.Join(dir, "samples")
+	if err := os.Mkdir(samples, 0o755); err != nil {
+		t.Fatalf("creating samples directory: %v", err)
+	}
+	dictionary := filepath.Join(dir, "banlist.txt")
+	if err := os.WriteFile(dictionary, []byte("bitcoin\nt.me\n"), 0o644); err != nil {
+		t.Fatalf("writing dictionary: %v", err)
+	}
+
+	s, err := storage.New(dir)
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	l, err := banlist.New(dictionary)
+	if err != nil {
+		t.Fatalf("creating dictionary: %v", err)
+	}
+	m, err := imgmatch.NewMatcher(samples, 10, 15)
+	if err != nil {
+		t.Fatalf("creating image matcher: %v", err)
+	}
+
+	cfg := &config.Config{
+		Token:                "TOKEN",
+		APIEndpoint:          srv.Endpoint(),
+		HTTPClient:           srv.Client(),
+		Samples:              samples,
+		Dictionary:           dictionary,
+		InterestingThreshold: 10,
+		SuspiciousThreshold:  15,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b, err := New(ctx, cfg, s, l, m)
+	if err != nil {
+		cancel()
+		t.Fatalf("creating bot: %v", err)
+	}
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			b.Wait()
+		})
+	}
+	t.Cleanup(stop)
+	return b, srv, stop
+}
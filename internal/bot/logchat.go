@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+// Undo buttons in the log chat have callback data like "log:unban:<chat>:<kind>:<id>".
+const logCallbackPrefix = "log:"
+
+const (
+	logUnbanAction   = "unban"
+	logUnmuteAction  = "unmute"
+	logTrustAction   = "trust"
+	logUntrustAction = "untrust"
+	logAllowAction   = "allow"
+	logRejectAction  = "reject"
+)
+
+func unbanButton(chatID int64, from sender) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(
+		"Unban",
+		fmt.Sprintf("%s%s:%d:%s:%d", logCallbackPrefix, logUnbanAction, chatID, from.kind, from.id),
+	)
+}
+
+func unmuteButton(chatID int64, from sender) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(
+		"Unmute",
+		fmt.Sprintf("%s%s:%d:%d", logCallbackPrefix, logUnmuteAction, chatID, from.id),
+	)
+}
+
+func trustButton(from sender) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(
+		"Trust",
+		fmt.Sprintf("%s%s:%d", logCallbackPrefix, logTrustAction, from.id),
+	)
+}
+
+func untrustButton(from sender) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(
+		"Untrust",
+		fmt.Sprintf("%s%s:%d", logCallbackPrefix, logUntrustAction, from.id),
+	)
+}
+
+func allowButton(msg *tgbotapi.Message) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(
+		"Not spam",
+		fmt.Sprintf("%s%s:%d:%d", logCallbackPrefix, logAllowAction, msg.Chat.ID, msg.MessageID),
+	)
+}
+
+func rejectReportsButton(msg *tgbotapi.Message) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(
+		"Reject reports",
+		fmt.Sprintf("%s%s:%d:%d", logCallbackPrefix, logRejectAction, msg.Chat.ID, msg.MessageID),
+	)
+}
+
+// processLogCallback handles the undo buttons in the log chat.
+func (b *Bot) processLogCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	if !b.storage.IsUserAdmin(callback.From.ID) {
+		b.requestSend(ctx, tgbotapi.NewCallback(callback.ID, "Only admins can do this"))
+		return nil
+	}
+
+	result, entry, err := b.undoLogAction(ctx, strings.Split(strings.TrimPrefix(callback.Data, logCallbackPrefix), ":"))
+	if err != nil {
+		b.requestSend(ctx, tgbotapi.NewCallback(callback.ID, "Error, see the logs"))
+		return err
+	}
+	b.requestSend(ctx, tgbotapi.NewCallback(callback.ID, result))
+	if entry.Action == "" {
+		return nil
+	}
+
+	entry.Target = fmt.Sprintf("%s:%d", senderUser, callback.From.ID)
+	// Not mirrored, the reply below is enough.
+	b.audit(ctx, storage.ChatSettings{}, entry, auditContext{})
+	if callback.Message != nil {
+		reply := tgbotapi.NewMessage(callback.Message.Chat.ID, fmt.Sprintf("%s by %s", result, callback.From.String()))
+		reply.ReplyToMessageID = callback.Message.MessageID
+		b.requestSend(ctx, reply)
+	}
+	return nil
+}
+
+// undoLogAction performs the action and returns the audit entry for it, if anything was done.
+func (b *Bot) undoLogAction(ctx context.Context, args []string) (string, storage.AuditEntry, error) {
+	var entry storage.AuditEntry
+	switch {
+	case args[0] == logUnbanAction && len(args) == 4:
+		chatID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing chat id: %w", err)
+		}
+		id, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing sender id: %w", err)
+		}
+		switch args[2] {
+		case senderUser.String():
+			b.requestSend(ctx, tgbotapi.UnbanChatMemberConfig{
+				ChatMemberConfig: tgbotapi.ChatMemberConfig{ChatID: chatID, UserID: id},
+				OnlyIfBanned:     true,
+			})
+		case senderChannel.String():
+			b.requestSend(ctx, tgbotapi.UnbanChatSenderChatConfig{ChatID: chatID, SenderChatID: id})
+		default:
+			return "", entry, fmt.Errorf("unexpected sender kind %s", args[2])
+		}
+		entry = storage.AuditEntry{ChatID: chatID, Action: "unban", Details: fmt.Sprintf("%s:%d", args[2], id)}
+		return fmt.Sprintf("Unbanned %s:%d", args[2], id), entry, nil
+	case args[0] == logUnmuteAction && len(args) == 3:
+		chatID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing chat id: %w", err)
+		}
+		id, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing user id: %w", err)
+		}
+		if err := b.storage.DeleteMute(chatID, id); err != nil {
+			return "", entry, fmt.Errorf("deleting mute: %w", err)
+		}
+		b.unmute(ctx, chatID, id)
+		entry = storage.AuditEntry{ChatID: chatID, Action: "unmute", Details: fmt.Sprintf("%s:%d", senderUser, id)}
+		return fmt.Sprintf("Unmuted %s:%d", senderUser, id), entry, nil
+	case (args[0] == logTrustAction || args[0] == logUntrustAction) && len(args) == 2:
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing user id: %w", err)
+		}
+		if args[0] == logTrustAction {
+			err = b.storage.TrustUser(id, 0, "trusted from the log chat")
+		} else {
+			err = b.storage.UntrustUser(id, 0, "revoked from the log chat")
+		}
+		if err != nil {
+			return "", entry, fmt.Errorf("changing trust: %w", err)
+		}
+		entry = storage.AuditEntry{Action: args[0], Details: fmt.Sprintf("%s:%d", senderUser, id)}
+		return fmt.Sprintf("Changed trust of %d: %s", id, args[0]), entry, nil
+	case args[0] == logAllowAction && len(args) == 3:
+		chatID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing chat id: %w", err)
+		}
+		messageID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing message id: %w", err)
+		}
+		result, err := b.undoDetection(ctx, chatID, messageID, false)
+		if err != nil {
+			return "", entry, err
+		}
+		entry = storage.AuditEntry{ChatID: chatID, Action: "notspam", Details: fmt.Sprintf("message %d", messageID)}
+		return result, entry, nil
+	case args[0] == logRejectAction && len(args) == 3:
+		chatID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing chat id: %w", err)
+		}
+		messageID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return "", entry, fmt.Errorf("parsing message id: %w", err)
+		}
+		// Only the reporters are penalized when the reports are rejected.
+		if err := b.settleReports(chatID, messageID, sender{}, false); err != nil {
+			return "", entry, err
+		}
+		entry = storage.AuditEntry{ChatID: chatID, Action: "reject_reports", Details: fmt.Sprintf("message %d", messageID)}
+		return "Rejected the reports", entry, nil
+	default:
+		return "Unknown action", entry, nil
+	}
+}
@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type correlationKey struct{}
+
+// withCorrelationID marks everything done on behalf of the event with a new ID,
+// including the requests it results in.
+func withCorrelationID(ctx context.Context) context.Context {
+	return context.WithValue(ctx, correlationKey{}, uuid.NewString())
+}
+
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// log returns the logger with the correlation ID of the context, if any.
+func (b *Bot) log(ctx context.Context) *logrus.Entry {
+	return withCorrelationField(b.logger, correlationID(ctx))
+}
+
+func withCorrelationField(logger *logrus.Entry, id string) *logrus.Entry {
+	if id == "" {
+		return logger
+	}
+	return logger.WithField("correlationID", id)
+}
+
+// redactor keeps the message content and the user names out of the logs, if configured.
+type redactor struct {
+	content bool
+	names   bool
+}
+
+func (r redactor) text(s string) string {
+	if r.content && s != "" {
+		return fmt.Sprintf("[%d bytes redacted]", len(s))
+	}
+	return s
+}
+
+func (r redactor) texts(values []string) []string {
+	if !r.content {
+		return values
+	}
+	redacted := make([]string, len(values))
+	for i, v := range values {
+		redacted[i] = r.text(v)
+	}
+	return redacted
+}
+
+func (r redactor) user(u *tgbotapi.User) string {
+	if u == nil {
+		return "none"
+	}
+	if r.names {
+		return fmt.Sprintf("%d", u.ID)
+	}
+	return fmt.Sprintf("%d (%s)", u.ID, u.String())
+}
+
+func (r redactor) chat(c *tgbotapi.Chat) string {
+	if c == nil {
+		return "none"
+	}
+	if r.names {
+		return fmt.Sprintf("%d", c.ID)
+	}
+	return fmt.Sprintf("%d (%s)", c.ID, c.Title+c.UserName)
+}
+
+// updateFields describes the update for the logs without its content.
+func updateFields(upd *tgbotapi.Update) logrus.Fields {
+	fields := logrus.Fields{
+		"updateID": upd.UpdateID,
+		"type":     updateType(upd),
+	}
+	msg := upd.Message
+	if msg == nil {
+		msg = upd.EditedMessage
+	}
+	if msg != nil {
+		fields["messageID"] = msg.MessageID
+		fields["sender"] = resolveSender(msg).String()
+		if msg.Chat != nil {
+			fields["chatID"] = msg.Chat.ID
+		}
+	}
+	if upd.CallbackQuery != nil && upd.CallbackQuery.From != nil {
+		fields["sender"] = fmt.Sprintf("%s:%d", senderUser, upd.CallbackQuery.From.ID)
+	}
+	return fields
+}
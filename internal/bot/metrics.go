@@ -0,0 +1,102 @@
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
+)
+
+// Polls return at least every uConf.Timeout seconds, so no poll for longer means it's stuck.
+const pollStaleAfter = 3 * time.Minute
+
+// instrumentedTransport measures the Bot API latency and notes the successful polls.
+type instrumentedTransport struct {
+	// lastPoll is the time of the last successful poll in nanoseconds, accessed atomically.
+	lastPoll int64
+	next     http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The API paths are /bot<token>/<method>, the file paths are /file/bot<token>/<path>.
+	if strings.HasPrefix(req.URL.Path, "/file/") {
+		return t.next.RoundTrip(req)
+	}
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	metrics.APILatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err == nil && method == "getUpdates" && resp.StatusCode == http.StatusOK {
+		atomic.StoreInt64(&t.lastPoll, time.Now().UnixNano())
+	}
+	return resp, err
+}
+
+// instrumentClient returns a copy of the client measuring its requests.
+func instrumentClient(client *http.Client) (*http.Client, *instrumentedTransport) {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	// Polling has just started.
+	t := &instrumentedTransport{lastPoll: time.Now().UnixNano(), next: next}
+	instrumented := *client
+	instrumented.Transport = t
+	return &instrumented, t
+}
+
+// Alive fails if updates haven't been polled successfully for a while.
+func (b *Bot) Alive() error {
+	last := time.Unix(0, atomic.LoadInt64(&b.transport.lastPoll))
+	if since := time.Since(last); since > pollStaleAfter {
+		return fmt.Errorf("no successful poll for %v", since.Truncate(time.Second))
+	}
+	return nil
+}
+
+func updateType(upd *tgbotapi.Update) string {
+	switch {
+	case upd.Message != nil:
+		return "message"
+	case upd.EditedMessage != nil:
+		return "edited_message"
+	case upd.CallbackQuery != nil:
+		return "callback_query"
+	case upd.ChannelPost != nil:
+		return "channel_post"
+	case upd.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case upd.MyChatMember != nil:
+		return "my_chat_member"
+	case upd.ChatMember != nil:
+		return "chat_member"
+	default:
+		return "other"
+	}
+}
+
+// requestAction names the action of the request for the metrics.
+func requestAction(c tgbotapi.Chattable) string {
+	switch c.(type) {
+	case tgbotapi.DeleteMessageConfig:
+		return "delete"
+	case tgbotapi.KickChatMemberConfig, tgbotapi.BanChatSenderChatConfig:
+		return "ban"
+	case tgbotapi.UnbanChatMemberConfig, tgbotapi.UnbanChatSenderChatConfig:
+		return "unban"
+	case tgbotapi.RestrictChatMemberConfig:
+		return "restrict"
+	case tgbotapi.MessageConfig, tgbotapi.PhotoConfig, tgbotapi.CopyMessageConfig:
+		return "message"
+	case tgbotapi.EditMessageTextConfig:
+		return "edit"
+	case tgbotapi.CallbackConfig:
+		return "callback"
+	default:
+		return "other"
+	}
+}
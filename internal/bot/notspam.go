@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// rememberAlert maps the alert to the message it's about once it's sent.
+func (b *Bot) rememberAlert(ctx context.Context, msg *tgbotapi.Message) func(*tgbotapi.Message) {
+	return func(alert *tgbotapi.Message) {
+		if alert == nil {
+			return
+		}
+		if err := b.storage.SetAlertMessage(msg.Chat.ID, alert.MessageID, msg.MessageID); err != nil {
+			b.log(ctx).Errorf("Error saving alert message: %v", err)
+		}
+	}
+}
+
+// processNotSpamCommand undoes a false positive. It's used in reply to the alert or to the message itself.
+// Matched images are allowlisted and the samples they matched are removed,
+// matched banned patterns are removed only with the "patterns" argument, as they are curated by hand.
+func (b *Bot) processNotSpamCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.ReplyToMessage == nil {
+		b.log(ctx).Warning("Notspam command called without reply")
+		return nil
+	}
+	chatID := msg.Chat.ID
+	messageID := msg.ReplyToMessage.MessageID
+	alertID, err := b.storage.GetAlertMessage(chatID, messageID)
+	if err != nil {
+		return fmt.Errorf("getting alert message: %w", err)
+	}
+	if alertID != 0 {
+		alertID, messageID = messageID, alertID
+	}
+
+	reply, err := b.undoDetection(ctx, chatID, messageID, msg.CommandArguments() == "patterns")
+	if err != nil {
+		return err
+	}
+	b.requestSend(ctx, tgbotapi.NewMessage(chatID, reply))
+	if alertID != 0 {
+		b.requestDelete(ctx, chatID, alertID)
+	}
+	return nil
+}
+
+// undoDetection allowlists the message images and removes the samples they matched,
+// along with the matched patterns if asked to. It returns the summary for the admin.
+func (b *Bot) undoDetection(ctx context.Context, chatID int64, messageID int, removePatterns bool) (string, error) {
+	d, err := b.storage.GetDetection(chatID, messageID)
+	if err != nil {
+		return "", fmt.Errorf("getting detection: %w", err)
+	}
+	if d == nil {
+		return "Nothing was detected in this message", nil
+	}
+	b.log(ctx).Infof("Undoing detection of message %d from %s:%d (%s)", messageID, d.Sender, d.SenderID, d.Reason)
+
+	for i, fileID := range d.Photos {
+		img, err := b.downloadImg(ctx, fileID, nil)
+		if err != nil {
+			return "", fmt.Errorf("downloading image: %w", err)
+		}
+		name := fmt.Sprintf("%d_%d_%d", chatID, messageID, i)
+		if err := b.imgMatcher.Allow(name, img); err != nil {
+			return "", fmt.Errorf("allowlisting image: %w", err)
+		}
+	}
+	for _, name := range d.Samples {
+		if err := b.removeSample(name); err != nil {
+			return "", err
+		}
+	}
+
+	var removedPatterns []string
+	if removePatterns {
+		for _, pattern := range d.Patterns {
+			removed, err := b.banlist.Remove(pattern)
+			if err != nil {
+				return "", fmt.Errorf("removing pattern %q: %w", pattern, err)
+			}
+			if removed {
+				removedPatterns = append(removedPatterns, pattern)
+			}
+		}
+	}
+	return formatNotSpam(d.Photos, d.Samples, d.Patterns, removedPatterns), nil
+}
+
+func formatNotSpam(photos, samples, patterns, removedPatterns []string) string {
+	var sb strings.Builder
+	sb.WriteString("Marked as not spam.\n")
+	if len(photos) > 0 {
+		fmt.Fprintf(&sb, "Allowlisted images: %d\n", len(photos))
+	}
+	if len(samples) > 0 {
+		fmt.Fprintf(&sb, "Removed samples: %s\n", strings.Join(samples, ", "))
+	}
+	if len(removedPatterns) > 0 {
+		fmt.Fprintf(&sb, "Removed patterns: %s\n", strings.Join(removedPatterns, ", "))
+	} else if len(patterns) > 0 {
+		fmt.Fprintf(&sb, "Matched patterns: %s\nUse /notspam patterns to remove them\n", strings.Join(patterns, ", "))
+	}
+	return sb.String()
+}
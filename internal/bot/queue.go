@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"sync"
+
+	"github.com/pomo-mondreganto/goas/internal/metrics"
+)
+
+func newRequestQueue() *requestQueue {
+	return &requestQueue{ready: make(chan struct{}, 1)}
+}
+
+// requestQueue is an unbounded queue of outbound requests,
+// so that pushing never blocks the event handlers.
+type requestQueue struct {
+	mu     sync.Mutex
+	items  []*outboundRequest
+	closed bool
+	ready  chan struct{}
+}
+
+// push returns false if the queue is closed, the request has to be given up on then.
+func (q *requestQueue) push(r *outboundRequest) bool {
+	metrics.Actions.WithLabelValues(requestAction(r.c)).Inc()
+	metrics.QueueDepth.Inc()
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return false
+	}
+	q.items = append(q.items, r)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// popAll returns the queued requests in order and empties the queue.
+func (q *requestQueue) popAll() []*outboundRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// close makes the queue refuse new requests and returns the queued ones.
+func (q *requestQueue) close() []*outboundRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	items := q.items
+	q.items = nil
+	return items
+}
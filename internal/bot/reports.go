@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const (
+	// reportsToVote distinct trusted members have to report a message to start a vote.
+	reportsToVote  = 2
+	reportCooldown = time.Minute
+	// Reports of members with this many rejected reports are ignored.
+	maxRejectedReports = 3
+)
+
+// isAdminMention tells if the message is a reply calling for admins, it's handled as a report.
+func isAdminMention(msg *tgbotapi.Message) bool {
+	return msg.ReplyToMessage != nil && strings.Contains(strings.ToLower(msg.Text), "@admin")
+}
+
+// processReport handles /report from members. Reports only count from trusted members,
+// not too often, and not from those whose reports were rejected too many times.
+func (b *Bot) processReport(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.ReplyToMessage == nil {
+		b.log(ctx).Warning("Report without reply")
+		return nil
+	}
+	reporter := resolveSender(msg)
+	reported := msg.ReplyToMessage
+	target := resolveSender(reported)
+	chatID := msg.Chat.ID
+
+	logger := b.log(ctx).WithField("reporter", reporter.String()).WithField("chatID", chatID)
+	if reporter.kind != senderUser {
+		logger.Info("Ignoring report not from a user")
+		return nil
+	}
+	if !target.isAccountable() || target.kind == senderUser && (target.id == b.api.Self.ID || b.storage.IsUserAdmin(target.id)) {
+		logger.Infof("Ignoring report of %s", target)
+		return nil
+	}
+
+	reason, err := b.trustReason(reporter.id, chatID)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		logger.Info("Ignoring report from untrusted member")
+		return nil
+	}
+	rejected, err := b.storage.GetUserRejectedReports(reporter.id)
+	if err != nil {
+		return fmt.Errorf("getting rejected reports: %w", err)
+	}
+	if rejected >= maxRejectedReports {
+		logger.Infof("Ignoring report, %d reports were rejected", rejected)
+		return nil
+	}
+	now := time.Now()
+	last, err := b.storage.GetUserLastReport(reporter.id)
+	if err != nil {
+		return fmt.Errorf("getting last report: %w", err)
+	}
+	if now.Sub(last) < reportCooldown {
+		logger.Infof("Ignoring report, last one was at %v", last)
+		return nil
+	}
+	if err := b.storage.SetUserLastReport(reporter.id, now); err != nil {
+		return fmt.Errorf("setting last report: %w", err)
+	}
+
+	count, err := b.storage.AddReport(chatID, reported.MessageID, reporter.id, now)
+	if err != nil {
+		return fmt.Errorf("adding report: %w", err)
+	}
+	logger.Infof("%s reported, %d of %d reports", target, count, reportsToVote)
+
+	settings := b.chatSettings(chatID)
+	b.audit(ctx, settings, storage.AuditEntry{
+		ChatID:  chatID,
+		Action:  "report",
+		Target:  target.String(),
+		Details: fmt.Sprintf("by %s, %d of %d reports, message %d", reporter, count, reportsToVote, reported.MessageID),
+	}, auditContext{
+		about: reported,
+		undo:  []tgbotapi.InlineKeyboardButton{rejectReportsButton(reported)},
+	})
+	if count != reportsToVote {
+		return nil
+	}
+	pending, err := b.pendingVoteOn(chatID, reported.MessageID)
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		logger.Info("Message is already voted on")
+		return b.editVotePrompt(ctx, chatID, pending.PromptID, fmt.Sprintf("The message was reported by %d members.", count))
+	}
+	b.perform(ctx, settings, storage.AuditEntry{
+		ChatID:  chatID,
+		Action:  "vote",
+		Target:  target.String(),
+		Details: fmt.Sprintf("reported by %d members, message %d", count, reported.MessageID),
+	}, auditContext{
+		about: reported,
+		undo:  []tgbotapi.InlineKeyboardButton{trustButton(target)},
+	}, func() {
+		b.processSuspiciousMessage(ctx, reported)
+	})
+	return nil
+}
+
+// settleReports rewards or penalizes the reporters of the message once it's judged,
+// and lowers the reputation of the reported member if the message is spam.
+func (b *Bot) settleReports(chatID int64, messageID int, target sender, spam bool) error {
+	reporters, err := b.storage.GetReporters(chatID, messageID)
+	if err != nil {
+		return fmt.Errorf("getting reporters: %w", err)
+	}
+	for _, id := range reporters {
+		rejected, err := b.storage.GetUserRejectedReports(id)
+		if err != nil {
+			return fmt.Errorf("getting rejected reports: %w", err)
+		}
+		switch {
+		case !spam:
+			_, err = b.storage.IncUserRejectedReports(id, 1)
+		case rejected > 0:
+			// A good report makes up for a rejected one.
+			_, err = b.storage.IncUserRejectedReports(id, -1)
+		}
+		if err != nil {
+			return fmt.Errorf("changing rejected reports: %w", err)
+		}
+		if spam && target.kind == senderUser {
+			if err := b.storage.AddReputationReport(chatID, target.id); err != nil {
+				return fmt.Errorf("lowering reputation: %w", err)
+			}
+		}
+	}
+	if err := b.storage.DeleteReports(chatID, messageID); err != nil {
+		return fmt.Errorf("deleting reports: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettleReports(t *testing.T) {
+	b := newUnitBot(t)
+	const reported = 70
+	reporters := []int64{71, 72}
+	report := func(messageID int) {
+		for _, id := range reporters {
+			if _, err := b.storage.AddReport(testChatID, messageID, id, time.Now()); err != nil {
+				t.Fatalf("adding report: %v", err)
+			}
+		}
+	}
+	check := func(wantReports int, wantRejected int64) {
+		t.Helper()
+		r, _, err := b.storage.GetReputation(testChatID, reported)
+		if err != nil {
+			t.Fatalf("getting reputation: %v", err)
+		}
+		if r.Reports != wantReports {
+			t.Fatalf("got %d reports in reputation, expected %d", r.Reports, wantReports)
+		}
+		for _, id := range reporters {
+			rejected, err := b.storage.GetUserRejectedReports(id)
+			if err != nil {
+				t.Fatalf("getting rejected reports: %v", err)
+			}
+			if rejected != wantRejected {
+				t.Fatalf("got %d rejected reports of %d, expected %d", rejected, id, wantRejected)
+			}
+		}
+	}
+	target := sender{kind: senderUser, id: reported}
+
+	report(1)
+	if err := b.settleReports(testChatID, 1, target, false); err != nil {
+		t.Fatalf("settling reports: %v", err)
+	}
+	check(0, 1)
+
+	report(2)
+	if err := b.settleReports(testChatID, 2, target, true); err != nil {
+		t.Fatalf("settling reports: %v", err)
+	}
+	check(len(reporters), 0)
+
+	// The reports are settled once.
+	if err := b.settleReports(testChatID, 2, target, true); err != nil {
+		t.Fatalf("settling reports: %v", err)
+	}
+	check(len(reporters), 0)
+}
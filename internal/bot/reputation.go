@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const (
+	cleanDayReputation     = 1
+	trustedReplyReputation = 2
+	passedVoteReputation   = 5
+	strikeReputation       = -10
+	reportReputation       = -2
+
+	minReputation = -100
+	maxReputation = 100
+	// Manually trusted members have the maximum reputation, their messages are still checked.
+	trustedReputation = maxReputation
+
+	// Members with this reputation are trusted to report and have a bigger vote.
+	reputableReputation = 20
+	// Members with less can't vote.
+	minVoterReputation = 2
+
+	// Members from before reputation get a clean day for every message, up to this.
+	// The ones the automatic trust covered, for their tenure or their messages, get it all,
+	// so that they stay reputable.
+	maxSeededCleanDays = reputableReputation
+	seededTenure       = 180 * 24 * time.Hour
+	seededMessages     = 10
+
+	// A message is suspicious if its detections score at least the threshold,
+	// which grows with the sender's reputation, but not beyond the maximum,
+	// so that a hijacked account is still caught.
+	baseSpamThreshold           = 2
+	maxSpamThreshold            = 8
+	reputationPerThresholdPoint = 10
+)
+
+func reputationScore(r storage.Reputation) int {
+	score := r.CleanDays*cleanDayReputation +
+		r.TrustedReplies*trustedReplyReputation +
+		r.PassedVotes*passedVoteReputation +
+		r.Strikes*strikeReputation +
+		r.Reports*reportReputation
+	if score < minReputation {
+		return minReputation
+	}
+	if score > maxReputation {
+		return maxReputation
+	}
+	return score
+}
+
+func spamThreshold(reputation int) int {
+	if reputation < 0 {
+		return baseSpamThreshold
+	}
+	threshold := baseSpamThreshold + reputation/reputationPerThresholdPoint
+	if threshold > maxSpamThreshold {
+		return maxSpamThreshold
+	}
+	return threshold
+}
+
+// reputation returns the user's reputation in the chat and where it comes from.
+func (b *Bot) reputation(userID int64, chatID int64) (int, string, error) {
+	trust, err := b.storage.GetTrust(userID, chatID)
+	if err != nil {
+		return 0, "", fmt.Errorf("getting trust: %w", err)
+	}
+	if trust != nil && !trust.Revoked {
+		return trustedReputation, trust.Reason, nil
+	}
+
+	r, found, err := b.storage.GetReputation(chatID, userID)
+	if err != nil {
+		return 0, "", fmt.Errorf("getting reputation: %w", err)
+	}
+	if !found {
+		if r, err = b.seedReputation(userID, chatID); err != nil {
+			return 0, "", err
+		}
+	}
+	score := reputationScore(r)
+	if trust != nil && score > 0 {
+		// Revoked trust.
+		return 0, trust.Reason, nil
+	}
+	return score, formatReputation(r), nil
+}
+
+// seedReputation gives members from before reputation some credit for their messages and tenure.
+func (b *Bot) seedReputation(userID int64, chatID int64) (storage.Reputation, error) {
+	count, err := b.storage.GetUserChatMessageCount(userID, chatID)
+	if err != nil {
+		return storage.Reputation{}, fmt.Errorf("getting message count: %w", err)
+	}
+	firstSeen, err := b.storage.GetOrSetUserFirstSeen(userID, time.Now())
+	if err != nil {
+		return storage.Reputation{}, fmt.Errorf("getting first seen: %w", err)
+	}
+	// The message being checked is already counted, it's not known to be clean yet.
+	r := storage.Reputation{CleanDays: int(count) - 1}
+	if r.CleanDays < 0 {
+		r.CleanDays = 0
+	}
+	if r.CleanDays > maxSeededCleanDays || count > seededMessages || time.Since(firstSeen) >= seededTenure {
+		r.CleanDays = maxSeededCleanDays
+	}
+	if err := b.storage.SeedReputation(chatID, userID, r); err != nil {
+		return r, fmt.Errorf("seeding reputation: %w", err)
+	}
+	return r, nil
+}
+
+func formatReputation(r storage.Reputation) string {
+	return fmt.Sprintf(
+		"reputation %d: %d clean days, %d trusted replies, %d passed votes, %d strikes, %d reports",
+		reputationScore(r), r.CleanDays, r.TrustedReplies, r.PassedVotes, r.Strikes, r.Reports,
+	)
+}
+
+// trustReason tells why the sender can be trusted with reports and votes,
+// the reason is empty if they can't.
+func (b *Bot) trustReason(senderID int64, chatID int64) (string, error) {
+	if b.storage.IsUserAdmin(senderID) {
+		return "admin", nil
+	}
+	score, reason, err := b.reputation(senderID, chatID)
+	if err != nil {
+		return "", err
+	}
+	if score < reputableReputation {
+		return "", nil
+	}
+	return reason, nil
+}
+
+// earnReputation credits the clean messages, and the replies of reputable members.
+func (b *Bot) earnReputation(ctx context.Context, from sender, msgs []*tgbotapi.Message) {
+	if from.kind != senderUser {
+		return
+	}
+	msg := msgs[0]
+	chatID := msg.Chat.ID
+	now := time.Now()
+	if err := b.storage.AddCleanDay(chatID, from.id, now); err != nil {
+		b.log(ctx).Errorf("Error adding clean day of %s: %v", from, err)
+	}
+
+	if msg.ReplyToMessage == nil {
+		return
+	}
+	to := resolveSender(msg.ReplyToMessage)
+	if to.kind != senderUser || to.id == from.id || to.id == b.api.Self.ID {
+		return
+	}
+	reason, err := b.trustReason(from.id, chatID)
+	if err != nil {
+		b.log(ctx).Errorf("Error checking trust of %s: %v", from, err)
+		return
+	}
+	if reason == "" {
+		return
+	}
+	if err := b.storage.AddTrustedReply(chatID, to.id, now); err != nil {
+		b.log(ctx).Errorf("Error adding trusted reply to %s: %v", to, err)
+	}
+}
+
+func (b *Bot) processReputationCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.ReplyToMessage == nil {
+		b.log(ctx).Warning("Reputation command called without reply")
+		return nil
+	}
+	from := resolveSender(msg.ReplyToMessage)
+	if from.kind != senderUser {
+		b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("%s has no reputation", from)))
+		return nil
+	}
+	score, reason, err := b.reputation(from.id, msg.Chat.ID)
+	if err != nil {
+		return err
+	}
+	b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf(
+		"%s: %d (%s), spam threshold %d",
+		from, score, reason, spamThreshold(score),
+	)))
+	return nil
+}
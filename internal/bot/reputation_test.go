@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeedReputation(t *testing.T) {
+	b := newUnitBot(t)
+	now := time.Now()
+	for _, tc := range []struct {
+		name      string
+		userID    int64
+		firstSeen time.Time
+		messages  int64
+		want      int
+	}{
+		{name: "newcomer", userID: 1, firstSeen: now, messages: 1, want: 0},
+		{name: "few messages", userID: 2, firstSeen: now.Add(-24 * time.Hour), messages: 4, want: 3 * cleanDayReputation},
+		{name: "active", userID: 3, firstSeen: now.Add(-24 * time.Hour), messages: seededMessages + 1, want: reputableReputation},
+		{name: "old member", userID: 4, firstSeen: now.Add(-seededTenure), messages: 1, want: reputableReputation},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			userID := tc.userID
+			if _, err := b.storage.GetOrSetUserFirstSeen(userID, tc.firstSeen); err != nil {
+				t.Fatalf("setting first seen: %v", err)
+			}
+			if _, err := b.storage.IncUserChatMessageCount(userID, testChatID, tc.messages); err != nil {
+				t.Fatalf("setting message count: %v", err)
+			}
+			score, _, err := b.reputation(userID, testChatID)
+			if err != nil {
+				t.Fatalf("getting reputation: %v", err)
+			}
+			if score != tc.want {
+				t.Fatalf("got reputation %d, expected %d", score, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+// The restriction outlives the vote deadline a bit, so that Telegram
+// lifts it by itself if the bot is down when the vote expires.
+const restrictionMargin = time.Hour
+
+// restrictSuspect mutes the sender until the vote on the message resolves,
+// and hides the message if the chat wants it.
+func (b *Bot) restrictSuspect(ctx context.Context, settings storage.ChatSettings, msg *tgbotapi.Message, promptID int, deadline time.Time) {
+	if !settings.MuteSuspects {
+		return
+	}
+	from := resolveSender(msg)
+	if from.kind != senderUser || from.id == b.api.Self.ID || b.storage.IsUserAdmin(from.id) {
+		return
+	}
+	// Restricting a muted sender would replace their mute.
+	if mute, err := b.storage.GetMute(msg.Chat.ID, from.id); err != nil {
+		b.log(ctx).Errorf("Error getting mute of %s: %v", from, err)
+	} else if mute != nil && mute.Active(time.Now()) {
+		return
+	}
+
+	chatID := msg.Chat.ID
+	r := storage.Restriction{
+		ChatID:   chatID,
+		UserID:   from.id,
+		PromptID: promptID,
+		Until:    deadline.Add(restrictionMargin),
+		Hidden:   settings.HideSuspicious,
+	}
+	details := fmt.Sprintf("until the vote on message %d resolves", msg.MessageID)
+	if r.Hidden {
+		details += ", message hidden"
+	}
+	b.perform(ctx, settings, storage.AuditEntry{
+		ChatID:  chatID,
+		Action:  "mute",
+		Target:  from.String(),
+		Details: details,
+	}, auditContext{about: msg}, func() {
+		if err := b.storage.AddRestriction(r); err != nil {
+			b.log(ctx).Errorf("Error saving restriction: %v", err)
+			return
+		}
+		b.log(ctx).Infof("Muting %s until %v", from, r.Until)
+		b.requestSend(ctx, tgbotapi.RestrictChatMemberConfig{
+			ChatMemberConfig: tgbotapi.ChatMemberConfig{ChatID: chatID, UserID: from.id},
+			UntilDate:        r.Until.Unix(),
+			Permissions:      &tgbotapi.ChatPermissions{},
+		})
+		if r.Hidden {
+			b.requestDelete(ctx, chatID, msg.MessageID)
+		}
+	})
+}
+
+// takeRestriction returns the restriction of the vote, if any, so that the sweeper doesn't lift it too.
+// It must be taken before the vote is resolved.
+func (b *Bot) takeRestriction(ctx context.Context, chatID int64, promptID int) *storage.Restriction {
+	r, err := b.storage.TakeRestriction(chatID, promptID)
+	if err != nil {
+		b.log(ctx).Errorf("Error getting restriction of vote %d: %v", promptID, err)
+		return nil
+	}
+	return r
+}
+
+// liftRestriction unmutes the sender unless a sanction keeps them muted,
+// and reposts the hidden message, if there's one to restore.
+func (b *Bot) liftRestriction(ctx context.Context, r *storage.Restriction, reason string, msg *tgbotapi.Message) {
+	if r == nil {
+		return
+	}
+	b.audit(ctx, b.chatSettings(r.ChatID), storage.AuditEntry{
+		ChatID:  r.ChatID,
+		Action:  "unmute",
+		Target:  fmt.Sprintf("%s:%d", senderUser, r.UserID),
+		Details: reason,
+	}, auditContext{about: msg})
+
+	if r.Hidden && msg != nil {
+		b.restoreMessage(ctx, msg)
+	}
+	mute, err := b.storage.GetMute(r.ChatID, r.UserID)
+	if err != nil {
+		b.log(ctx).Errorf("Error getting mute of user %d: %v", r.UserID, err)
+		return
+	}
+	if mute != nil && mute.Active(time.Now()) {
+		b.log(ctx).Infof("User %d in chat %d stays muted until %v", r.UserID, r.ChatID, mute.Until)
+		return
+	}
+	b.unmute(ctx, r.ChatID, r.UserID)
+}
+
+// unmute gives the user the chat's default permissions back. They are looked up
+// in the background, so that the caller isn't held up by the API.
+func (b *Bot) unmute(ctx context.Context, chatID int64, userID int64) {
+	b.log(ctx).Infof("Unmuting user %d in chat %d", userID, chatID)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.requestSend(ctx, tgbotapi.RestrictChatMemberConfig{
+			ChatMemberConfig: tgbotapi.ChatMemberConfig{ChatID: chatID, UserID: userID},
+			Permissions:      b.chatPermissions(ctx, chatID),
+		})
+	}()
+}
+
+// chatPermissions returns the chat's default member permissions,
+// or the permissions to send anything if they can't be fetched.
+func (b *Bot) chatPermissions(ctx context.Context, chatID int64) *tgbotapi.ChatPermissions {
+	fallback := &tgbotapi.ChatPermissions{
+		CanSendMessages:       true,
+		CanSendMediaMessages:  true,
+		CanSendPolls:          true,
+		CanSendOtherMessages:  true,
+		CanAddWebPagePreviews: true,
+	}
+	if wait := b.globalLimit.reserve(time.Now()); wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return fallback
+		}
+	}
+	chat, err := b.api.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: chatID}})
+	if err != nil {
+		b.log(ctx).Errorf("Error getting chat %d permissions: %v", chatID, err)
+		return fallback
+	}
+	if chat.Permissions == nil {
+		return fallback
+	}
+	return chat.Permissions
+}
+
+// restoreMessage reposts the hidden message on behalf of the bot,
+// the original can't be brought back.
+func (b *Bot) restoreMessage(ctx context.Context, msg *tgbotapi.Message) {
+	header := fmt.Sprintf("Restored message from %s:", resolveSender(msg))
+	if len(msg.Photo) > 0 {
+		photo := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileID(msg.Photo[len(msg.Photo)-1].FileID))
+		photo.Caption = header
+		if msg.Caption != "" {
+			photo.Caption += "\n\n" + msg.Caption
+		}
+		b.requestSend(ctx, photo)
+		return
+	}
+	text := msg.Text
+	if text == "" {
+		text = "(the message can't be restored)"
+	}
+	b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, header+"\n\n"+text))
+}
+
+// releaseRestrictions lifts the restrictions whose votes are gone, e.g. resolved while
+// the bot was down, or are long overdue.
+func (b *Bot) releaseRestrictions(ctx context.Context) {
+	restrictions, err := b.storage.GetRestrictions()
+	if err != nil {
+		b.log(ctx).Errorf("Error getting restrictions: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, r := range restrictions {
+		pending, err := b.storage.GetPendingVote(r.ChatID, r.PromptID)
+		if err != nil {
+			b.log(ctx).Errorf("Error getting pending vote %d: %v", r.PromptID, err)
+			continue
+		}
+		if pending != nil && r.Until.After(now) {
+			continue
+		}
+		if taken := b.takeRestriction(ctx, r.ChatID, r.PromptID); taken != nil {
+			b.liftRestriction(ctx, taken, "vote is gone", nil)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+func muteSuspects(t *testing.T, b *Bot) {
+	t.Helper()
+	if err := b.storage.SetChatSettings(testChatID, storage.ChatSettings{MuteSuspects: true}); err != nil {
+		t.Fatalf("setting chat settings: %v", err)
+	}
+}
+
+func TestUnmuteRestoresChatPermissions(t *testing.T) {
+	b, srv := startTestBot(t)
+	muteSuspects(t, b)
+	defaults := tgbotapi.ChatPermissions{CanSendMessages: true, CanInviteUsers: true}
+	srv.SetChatPermissions(defaults)
+
+	suspect := textMessage(60, 48, "cheap bitcoin at t.me/spam")
+	runScript(srv, tgbotapi.Update{Message: suspect})
+	prompt := waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "60"}))
+	waitCall(t, srv, "restrictChatMember", chatParams(map[string]string{"user_id": "48"}))
+
+	runScript(srv, tgbotapi.Update{CallbackQuery: voteCallback("5", testAdminID, prompt.MessageID, suspect, voteNotSpamCallback)})
+	calls, err := srv.WaitCalls("restrictChatMember", 2, callTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got tgbotapi.ChatPermissions
+	if err := json.Unmarshal([]byte(calls[1].Params.Get("permissions")), &got); err != nil {
+		t.Fatalf("parsing permissions: %v", err)
+	}
+	if got != defaults {
+		t.Fatalf("got permissions %+v, expected the chat's %+v", got, defaults)
+	}
+}
+
+func TestVoteDoesNotLiftSanctionMute(t *testing.T) {
+	b, srv := startTestBot(t)
+	muteSuspects(t, b)
+
+	suspect := textMessage(70, 49, "cheap bitcoin at t.me/spam")
+	runScript(srv, tgbotapi.Update{Message: suspect})
+	prompt := waitCall(t, srv, "sendMessage", chatParams(map[string]string{"reply_to_message_id": "70"}))
+	waitCall(t, srv, "restrictChatMember", chatParams(map[string]string{"user_id": "49"}))
+
+	mute := commandMessage(71, testAdminID, "mute", suspect)
+	mute.Text += " 1h"
+	runScript(srv, tgbotapi.Update{Message: mute})
+	if _, err := srv.WaitCalls("restrictChatMember", 2, callTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	runScript(srv, tgbotapi.Update{CallbackQuery: voteCallback("6", testAdminID, prompt.MessageID, suspect, voteNotSpamCallback)})
+	waitCall(t, srv, "deleteMessage", chatParams(map[string]string{"message_id": strconv.Itoa(prompt.MessageID)}))
+	// The unmute would be sent in the background.
+	time.Sleep(200 * time.Millisecond)
+	if calls := srv.Calls("restrictChatMember"); len(calls) != 2 {
+		t.Fatalf("got %d restrictions, expected the mute to stay", len(calls))
+	}
+}
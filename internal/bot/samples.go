@@ -5,36 +5,82 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
+	"github.com/pomo-mondreganto/goas/internal/storage"
 )
 
-func (b *Bot) addImageSample(ctx context.Context, fileID string) error {
+// addImageSample returns the name of the new sample, or an empty string if it's not interesting.
+func (b *Bot) addImageSample(ctx context.Context, fileID string) (string, error) {
 	filename := fmt.Sprintf("sample_%s.jpeg", uuid.New())
 	dst := filepath.Join(b.samplesPath, filename)
-	b.logger.Debugf("Saving new sample to %s", dst)
+	b.log(ctx).Debugf("Saving new sample to %s", dst)
 	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE, 0666)
 	if err != nil {
-		return fmt.Errorf("opening sample file: %w", err)
+		return "", fmt.Errorf("opening sample file: %w", err)
 	}
 	interesting := true
 	defer func() {
 		if err := file.Close(); err != nil {
-			b.logger.Errorf("Error closing sample file: %v", err)
+			b.log(ctx).Errorf("Error closing sample file: %v", err)
 		}
 		if !interesting {
 			if err := os.Remove(file.Name()); err != nil {
-				b.logger.Errorf("Error removing sample: %v", err)
+				b.log(ctx).Errorf("Error removing sample: %v", err)
 			}
 		}
 	}()
 
 	img, err := b.downloadImg(ctx, fileID, file)
 	if err != nil {
-		return fmt.Errorf("downloading image: %w", err)
+		return "", fmt.Errorf("downloading image: %w", err)
 	}
 	if interesting, err = b.imgMatcher.AddSample(filename, img); err != nil {
-		return fmt.Errorf("checking image: %w", err)
+		return "", fmt.Errorf("checking image: %w", err)
+	}
+	if !interesting {
+		return "", nil
+	}
+	return filename, nil
+}
+
+// learnSamples adds the message photos as samples and remembers them in the message detection,
+// so that they can be undone later.
+func (b *Bot) learnSamples(ctx context.Context, msg *tgbotapi.Message) error {
+	var added []string
+	for _, ps := range msg.Photo {
+		name, err := b.addImageSample(ctx, ps.FileID)
+		if err != nil {
+			return fmt.Errorf("adding image sample: %w", err)
+		}
+		if name != "" {
+			added = append(added, name)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	d, err := b.storage.GetDetection(msg.Chat.ID, msg.MessageID)
+	if err != nil {
+		return fmt.Errorf("getting detection: %w", err)
+	}
+	if d == nil {
+		from := resolveSender(msg)
+		d = &storage.Detection{
+			Time:     time.Now(),
+			Sender:   from.kind.String(),
+			SenderID: from.id,
+			Verdict:  definitelySpam.String(),
+			Reason:   "reported spam",
+			Photos:   largestPhotos([]*tgbotapi.Message{msg}),
+		}
+	}
+	d.Samples = uniqueStrings(append(d.Samples, added...))
+	if err := b.storage.SaveDetection(msg.Chat.ID, msg.MessageID, *d); err != nil {
+		return fmt.Errorf("saving detection: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,278 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const (
+	sanctionWarn = "warn"
+	sanctionMute = "mute"
+	sanctionBan  = "ban"
+
+	defaultStrikeDecay = 30 * 24 * time.Hour
+	// Telegram treats shorter restrictions as permanent.
+	minSanctionDuration = time.Minute
+)
+
+// A spam verdict used to be a permanent ban, so it's the default ladder.
+var defaultSanctions = []sanction{{kind: sanctionBan}}
+
+// sanction is a step of the escalation ladder, zero duration means permanent.
+type sanction struct {
+	kind     string
+	duration time.Duration
+}
+
+func (s sanction) String() string {
+	if s.duration == 0 {
+		return s.kind
+	}
+	return fmt.Sprintf("%s:%v", s.kind, s.duration)
+}
+
+func (s sanction) untilDate() int64 {
+	if s.duration == 0 {
+		return 0
+	}
+	return time.Now().Add(s.duration).Unix()
+}
+
+// parseSanction parses steps like "warn", "mute:1h", "ban:24h" or "ban".
+func parseSanction(value string) (sanction, error) {
+	kind, d, timed := strings.Cut(value, ":")
+	s := sanction{kind: kind}
+	switch kind {
+	case sanctionWarn:
+		if timed {
+			return s, fmt.Errorf("warnings can't have a duration")
+		}
+		return s, nil
+	case sanctionMute, sanctionBan:
+		if !timed {
+			return s, nil
+		}
+		duration, err := parseSanctionDuration(d)
+		if err != nil {
+			return s, err
+		}
+		s.duration = duration
+		return s, nil
+	default:
+		return s, fmt.Errorf("unknown sanction %s, known: %s, %s, %s", kind, sanctionWarn, sanctionMute, sanctionBan)
+	}
+}
+
+func parseSanctionDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+	if d < minSanctionDuration {
+		return 0, fmt.Errorf("duration must be at least %v", minSanctionDuration)
+	}
+	return d, nil
+}
+
+// sanctionLadder skips the invalid steps, they are validated when the settings are changed.
+func sanctionLadder(settings storage.ChatSettings) []sanction {
+	var ladder []sanction
+	for _, step := range settings.Sanctions {
+		if s, err := parseSanction(step); err == nil {
+			ladder = append(ladder, s)
+		}
+	}
+	if len(ladder) == 0 {
+		return defaultSanctions
+	}
+	return ladder
+}
+
+func strikeDecay(settings storage.ChatSettings) time.Duration {
+	if settings.StrikeDecay > 0 {
+		return settings.StrikeDecay
+	}
+	return defaultStrikeDecay
+}
+
+// addStrike returns the strike count of the sender, zero if they can't have strikes.
+// Strikes decay, but the reputation they cost doesn't come back.
+func (b *Bot) addStrike(ctx context.Context, settings storage.ChatSettings, chatID int64, from sender) int {
+	if from.kind != senderUser {
+		return 0
+	}
+	if err := b.storage.AddReputationStrike(chatID, from.id); err != nil {
+		b.log(ctx).Errorf("Error lowering reputation of %s: %v", from, err)
+	}
+	count, err := b.storage.AddStrike(chatID, from.id, time.Now(), strikeDecay(settings))
+	if err != nil {
+		b.log(ctx).Errorf("Error adding strike to %s: %v", from, err)
+		return 0
+	}
+	return count
+}
+
+// punish applies the next step of the chat's ladder to the spam sender,
+// the sender is unmuted if the vote muted them and the step is just a warning.
+func (b *Bot) punish(ctx context.Context, msg *tgbotapi.Message, restriction *storage.Restriction) {
+	from := resolveSender(msg)
+	if !b.canSanction(ctx, from) {
+		return
+	}
+	settings := b.chatSettings(msg.Chat.ID)
+	strike := b.addStrike(ctx, settings, msg.Chat.ID, from)
+
+	ladder := sanctionLadder(settings)
+	step := strike
+	if step < 1 {
+		step = 1
+	}
+	if step > len(ladder) {
+		step = len(ladder)
+	}
+	s := ladder[step-1]
+	b.log(ctx).Infof("Strike %d of %s, applying %s", strike, from, s)
+	b.sanctionSender(ctx, msg, s, strike, true)
+	if s.kind == sanctionWarn {
+		b.liftRestriction(ctx, restriction, "warned instead", nil)
+	}
+}
+
+func (b *Bot) canSanction(ctx context.Context, from sender) bool {
+	switch from.kind {
+	case senderUser:
+		if from.id == b.api.Self.ID {
+			b.log(ctx).Warning("Trying to sanction me")
+			return false
+		}
+		if b.storage.IsUserAdmin(from.id) {
+			b.log(ctx).Warning("Trying to sanction admin")
+			return false
+		}
+		return true
+	case senderChannel:
+		return true
+	default:
+		b.log(ctx).Warningf("Trying to sanction %s", from)
+		return false
+	}
+}
+
+// sanctionSender applies the sanction to the sender of the message.
+// Spam is deleted once it's copied to the log chat, along with the sender's
+// recent messages if they are banned.
+func (b *Bot) sanctionSender(ctx context.Context, msg *tgbotapi.Message, s sanction, strike int, spam bool) {
+	from := resolveSender(msg)
+	chatID := msg.Chat.ID
+	msgID := msg.MessageID
+	if !b.canSanction(ctx, from) {
+		return
+	}
+	if from.kind == senderChannel && s.kind != sanctionWarn {
+		// Channels can't be muted or banned for a while.
+		s = sanction{kind: sanctionBan}
+	}
+
+	details := fmt.Sprintf("message %d", msgID)
+	if s.duration > 0 {
+		details += fmt.Sprintf(", for %v", s.duration)
+	}
+	if strike > 0 {
+		details += fmt.Sprintf(", strike %d", strike)
+	}
+	ac := auditContext{about: msg}
+	switch s.kind {
+	case sanctionBan:
+		ac.undo = append(ac.undo, unbanButton(chatID, from))
+	case sanctionMute:
+		ac.undo = append(ac.undo, unmuteButton(chatID, from))
+	}
+	if spam {
+		if len(msg.Photo) > 0 {
+			ac.undo = append(ac.undo, allowButton(msg))
+		}
+		ac.content = msg
+		ac.then = func() {
+			b.log(ctx).Infof("Deleting message %d from %s", msgID, from)
+			b.requestDelete(ctx, chatID, msgID)
+			if s.kind == sanctionBan {
+				b.deleteRelatedMessages(ctx, from, msg)
+			}
+		}
+	}
+	b.audit(ctx, b.chatSettings(chatID), storage.AuditEntry{
+		ChatID:  chatID,
+		Action:  s.kind,
+		Target:  from.String(),
+		Details: details,
+	}, ac)
+
+	switch s.kind {
+	case sanctionWarn:
+		text := fmt.Sprintf("%s, this is a warning", senderLink(msg))
+		if strike > 0 {
+			text += fmt.Sprintf(" (strike %d)", strike)
+		}
+		m := tgbotapi.NewMessage(chatID, text+".")
+		m.ParseMode = tgbotapi.ModeHTML
+		b.log(ctx).Infof("Warning %s", from)
+		b.requestSend(ctx, m)
+	case sanctionMute:
+		b.log(ctx).Infof("Muting %s for %v", from, s.duration)
+		until := s.untilDate()
+		// It's recorded, so that lifting a vote restriction doesn't cut it short.
+		var m storage.Mute
+		if until != 0 {
+			m.Until = time.Unix(until, 0)
+		}
+		if err := b.storage.SetMute(chatID, from.id, m); err != nil {
+			b.log(ctx).Errorf("Error saving mute: %v", err)
+		}
+		b.requestSend(ctx, tgbotapi.RestrictChatMemberConfig{
+			ChatMemberConfig: tgbotapi.ChatMemberConfig{ChatID: chatID, UserID: from.id},
+			UntilDate:        until,
+			Permissions:      &tgbotapi.ChatPermissions{},
+		})
+	case sanctionBan:
+		if from.kind == senderChannel {
+			b.log(ctx).Infof("Banning channel %d", from.id)
+			b.requestSend(ctx, tgbotapi.BanChatSenderChatConfig{ChatID: chatID, SenderChatID: from.id})
+			return
+		}
+		b.log(ctx).Infof("Banning user %d for %v", from.id, s.duration)
+		b.requestSend(ctx, tgbotapi.KickChatMemberConfig{
+			ChatMemberConfig: tgbotapi.ChatMemberConfig{ChatID: chatID, UserID: from.id},
+			UntilDate:        s.untilDate(),
+		})
+	}
+}
+
+// processSanctionCommand handles /warn, /mute <duration> and /tban <duration>,
+// they count as strikes, so that the ladder escalates from there.
+func (b *Bot) processSanctionCommand(ctx context.Context, msg *tgbotapi.Message, kind string) {
+	if msg.ReplyToMessage == nil {
+		b.log(ctx).Warningf("%s command called without reply", msg.Command())
+		return
+	}
+	s := sanction{kind: kind}
+	if kind != sanctionWarn {
+		d, err := parseSanctionDuration(strings.TrimSpace(msg.CommandArguments()))
+		if err != nil {
+			b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Usage: /%s <duration>, e.g. 1h: %v", msg.Command(), err)))
+			return
+		}
+		s.duration = d
+	}
+
+	target := resolveSender(msg.ReplyToMessage)
+	if !b.canSanction(ctx, target) {
+		return
+	}
+	strike := b.addStrike(ctx, b.chatSettings(msg.Chat.ID), msg.Chat.ID, target)
+	b.sanctionSender(ctx, msg.ReplyToMessage, s, strike, false)
+}
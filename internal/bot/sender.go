@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type senderKind int
+
+const (
+	senderUnknown senderKind = iota
+	senderUser
+	senderChannel
+	senderAnonymousAdmin
+	senderLinkedChannel
+)
+
+func (k senderKind) String() string {
+	switch k {
+	case senderUser:
+		return "user"
+	case senderChannel:
+		return "channel"
+	case senderAnonymousAdmin:
+		return "anonymous_admin"
+	case senderLinkedChannel:
+		return "linked_channel"
+	case senderUnknown:
+		return "unknown"
+	}
+	return "unknown"
+}
+
+// sender is the identity a message is attributed to. For users ID is the user ID,
+// for everything sent on behalf of a chat it's the ID of that chat.
+type sender struct {
+	kind senderKind
+	id   int64
+}
+
+func (s sender) String() string {
+	return fmt.Sprintf("%s:%d", s.kind, s.id)
+}
+
+// isAccountable returns true for the senders that are subject to
+// bookkeeping, checks and sanctions.
+func (s sender) isAccountable() bool {
+	return s.kind == senderUser || s.kind == senderChannel
+}
+
+func resolveSender(msg *tgbotapi.Message) sender {
+	if msg.SenderChat != nil {
+		switch {
+		case msg.IsAutomaticForward:
+			return sender{kind: senderLinkedChannel, id: msg.SenderChat.ID}
+		case msg.Chat != nil && msg.SenderChat.ID == msg.Chat.ID:
+			return sender{kind: senderAnonymousAdmin, id: msg.SenderChat.ID}
+		default:
+			return sender{kind: senderChannel, id: msg.SenderChat.ID}
+		}
+	}
+	if msg.From != nil {
+		return sender{kind: senderUser, id: msg.From.ID}
+	}
+	return sender{kind: senderUnknown}
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testChatID  = -1001000000001
+	testAdminID = 143994885
+)
+
+// newUnitBot returns a bot that isn't connected to anything,
+// the requests it makes are left in its queue.
+func newUnitBot(t *testing.T) *Bot {
+	t.Helper()
+	s, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &Bot{
+		api:      &tgbotapi.BotAPI{Self: tgbotapi.User{ID: 1, IsBot: true, UserName: "goas_bot"}},
+		requests: newRequestQueue(),
+		storage:  s,
+		logger:   logrus.NewEntry(logger),
+	}
+}
+
+func TestSenders(t *testing.T) {
+	chat := &tgbotapi.Chat{ID: testChatID, Type: "supergroup"}
+	channel := &tgbotapi.Chat{ID: -1002000000002, Type: "channel"}
+	// Messages on behalf of chats come from these service accounts.
+	channelBot := &tgbotapi.User{ID: 136817688, IsBot: true}
+	groupBot := &tgbotapi.User{ID: 1087968824, IsBot: true}
+
+	for _, tc := range []struct {
+		name        string
+		msg         *tgbotapi.Message
+		want        sender
+		accountable bool
+		// ban is the request banning the sender, nil if they can't be sanctioned.
+		ban tgbotapi.Chattable
+	}{
+		{
+			name:        "user",
+			msg:         &tgbotapi.Message{From: &tgbotapi.User{ID: 42}, Chat: chat},
+			want:        sender{kind: senderUser, id: 42},
+			accountable: true,
+			ban: tgbotapi.KickChatMemberConfig{
+				ChatMemberConfig: tgbotapi.ChatMemberConfig{ChatID: testChatID, UserID: 42},
+			},
+		},
+		{
+			name:        "admin",
+			msg:         &tgbotapi.Message{From: &tgbotapi.User{ID: testAdminID}, Chat: chat},
+			want:        sender{kind: senderUser, id: testAdminID},
+			accountable: true,
+		},
+		{
+			name:        "me",
+			msg:         &tgbotapi.Message{From: &tgbotapi.User{ID: 1, IsBot: true}, Chat: chat},
+			want:        sender{kind: senderUser, id: 1},
+			accountable: true,
+		},
+		{
+			name:        "channel",
+			msg:         &tgbotapi.Message{From: channelBot, SenderChat: channel, Chat: chat},
+			want:        sender{kind: senderChannel, id: channel.ID},
+			accountable: true,
+			ban:         tgbotapi.BanChatSenderChatConfig{ChatID: testChatID, SenderChatID: channel.ID},
+		},
+		{
+			name: "anonymous admin",
+			msg:  &tgbotapi.Message{From: groupBot, SenderChat: chat, Chat: chat},
+			want: sender{kind: senderAnonymousAdmin, id: testChatID},
+		},
+		{
+			name: "linked channel",
+			msg:  &tgbotapi.Message{From: channelBot, SenderChat: channel, Chat: chat, IsAutomaticForward: true},
+			want: sender{kind: senderLinkedChannel, id: channel.ID},
+		},
+		{
+			name: "unknown",
+			msg:  &tgbotapi.Message{Chat: chat},
+			want: sender{kind: senderUnknown},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.msg.MessageID = 10
+			from := resolveSender(tc.msg)
+			if from != tc.want {
+				t.Fatalf("resolveSender() = %v, want %v", from, tc.want)
+			}
+			if got := from.isAccountable(); got != tc.accountable {
+				t.Errorf("isAccountable() = %v, want %v", got, tc.accountable)
+			}
+
+			b := newUnitBot(t)
+			ctx := context.Background()
+			if got := b.canSanction(ctx, from); got != (tc.ban != nil) {
+				t.Errorf("canSanction() = %v, want %v", got, tc.ban != nil)
+			}
+			b.sanctionSender(ctx, tc.msg, sanction{kind: sanctionBan}, 0, false)
+			var sent []tgbotapi.Chattable
+			for _, r := range b.requests.popAll() {
+				sent = append(sent, r.c)
+			}
+			var want []tgbotapi.Chattable
+			if tc.ban != nil {
+				want = append(want, tc.ban)
+			}
+			if !reflect.DeepEqual(sent, want) {
+				t.Errorf("banning sent %#v, want %#v", sent, want)
+			}
+		})
+	}
+}
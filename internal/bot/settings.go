@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const settingsUsage = "Usage: /settings [shadow on|off | shadow_detector <name> on|off | log_chat <id>|off | " +
+	"vote_timeout <duration> | vote_expiry keep|majority|delete | mute_suspects on|off | hide_suspicious on|off | " +
+	"sanctions <step>,...|default | strike_decay <duration>]"
+
+// processSettingsCommand shows or changes the chat settings.
+func (b *Bot) processSettingsCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	chatID := msg.Chat.ID
+	settings, err := b.storage.GetChatSettings(chatID)
+	if err != nil {
+		return fmt.Errorf("getting chat settings: %w", err)
+	}
+
+	reply, changed := updateSettings(&settings, strings.Fields(msg.CommandArguments()))
+	if changed {
+		if err := b.storage.SetChatSettings(chatID, settings); err != nil {
+			return fmt.Errorf("saving chat settings: %w", err)
+		}
+		b.audit(ctx, settings, storage.AuditEntry{
+			ChatID:  chatID,
+			Action:  "settings",
+			Target:  resolveSender(msg).String(),
+			Details: msg.CommandArguments(),
+		}, auditContext{})
+	}
+	b.requestSend(ctx, tgbotapi.NewMessage(chatID, reply))
+	return nil
+}
+
+func updateSettings(settings *storage.ChatSettings, args []string) (reply string, changed bool) {
+	if len(args) == 0 {
+		return formatSettings(*settings), false
+	}
+	switch {
+	case args[0] == "shadow" && len(args) == 2:
+		on, ok := parseSwitch(args[1])
+		if !ok {
+			return settingsUsage, false
+		}
+		settings.Shadow = on
+	case args[0] == "shadow_detector" && len(args) == 3:
+		if !contains(detectors, args[1]) {
+			return fmt.Sprintf("Unknown detector %s, known: %s", args[1], strings.Join(detectors, ", ")), false
+		}
+		on, ok := parseSwitch(args[2])
+		if !ok {
+			return settingsUsage, false
+		}
+		var shadowed []string
+		for _, d := range settings.ShadowDetectors {
+			if d != args[1] {
+				shadowed = append(shadowed, d)
+			}
+		}
+		if on {
+			shadowed = append(shadowed, args[1])
+		}
+		settings.ShadowDetectors = shadowed
+	case args[0] == "log_chat" && len(args) == 2:
+		if args[1] == "off" {
+			settings.LogChatID = 0
+			break
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Sprintf("Invalid chat id %s", args[1]), false
+		}
+		settings.LogChatID = id
+	case args[0] == "vote_timeout" && len(args) == 2:
+		timeout, err := time.ParseDuration(args[1])
+		if err != nil || timeout <= 0 {
+			return fmt.Sprintf("Invalid duration %s", args[1]), false
+		}
+		settings.VoteTimeout = timeout
+	case args[0] == "vote_expiry" && len(args) == 2:
+		if !contains(voteExpiryRules, args[1]) {
+			return fmt.Sprintf("Unknown rule %s, known: %s", args[1], strings.Join(voteExpiryRules, ", ")), false
+		}
+		settings.VoteExpiry = args[1]
+	case args[0] == "mute_suspects" && len(args) == 2:
+		on, ok := parseSwitch(args[1])
+		if !ok {
+			return settingsUsage, false
+		}
+		settings.MuteSuspects = on
+	case args[0] == "hide_suspicious" && len(args) == 2:
+		on, ok := parseSwitch(args[1])
+		if !ok {
+			return settingsUsage, false
+		}
+		settings.HideSuspicious = on
+	case args[0] == "sanctions" && len(args) == 2:
+		if args[1] == "default" {
+			settings.Sanctions = nil
+			break
+		}
+		var steps []string
+		for _, step := range strings.Split(args[1], ",") {
+			s, err := parseSanction(step)
+			if err != nil {
+				return fmt.Sprintf("Invalid step %s: %v", step, err), false
+			}
+			steps = append(steps, s.String())
+		}
+		settings.Sanctions = steps
+	case args[0] == "strike_decay" && len(args) == 2:
+		decay, err := time.ParseDuration(args[1])
+		if err != nil || decay <= 0 {
+			return fmt.Sprintf("Invalid duration %s", args[1]), false
+		}
+		settings.StrikeDecay = decay
+	default:
+		return settingsUsage, false
+	}
+	return formatSettings(*settings), true
+}
+
+func formatSettings(settings storage.ChatSettings) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Shadow mode: %t\n", settings.Shadow)
+	if len(settings.ShadowDetectors) > 0 {
+		fmt.Fprintf(&sb, "Shadow detectors: %s\n", strings.Join(settings.ShadowDetectors, ", "))
+	}
+	if settings.LogChatID != 0 {
+		fmt.Fprintf(&sb, "Log chat: %d\n", settings.LogChatID)
+	}
+	fmt.Fprintf(&sb, "Vote timeout: %v, then: %s\n", voteTimeout(settings), voteExpiry(settings))
+	fmt.Fprintf(&sb, "Mute suspects: %t, hide their messages: %t\n", settings.MuteSuspects, settings.HideSuspicious)
+	var steps []string
+	for _, s := range sanctionLadder(settings) {
+		steps = append(steps, s.String())
+	}
+	fmt.Fprintf(&sb, "Sanctions: %s, a strike expires after %v\n", strings.Join(steps, ", "), strikeDecay(settings))
+	return sb.String()
+}
+
+func parseSwitch(s string) (on bool, ok bool) {
+	switch s {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	}
+	return false, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const trustedPageSize = 20
+
+// trustScope is the chat the command's trust change is limited to, zero means everywhere.
+func trustScope(msg *tgbotapi.Message) (int64, bool) {
+	switch strings.TrimSpace(msg.CommandArguments()) {
+	case "":
+		return 0, true
+	case "here":
+		return msg.Chat.ID, true
+	default:
+		return 0, false
+	}
+}
+
+func formatTrustScope(chatID int64) string {
+	if chatID == 0 {
+		return "everywhere"
+	}
+	return fmt.Sprintf("in chat %d", chatID)
+}
+
+// processTrustCommand trusts the sender of the replied message everywhere, or only in the chat with "here".
+func (b *Bot) processTrustCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.ReplyToMessage == nil {
+		b.log(ctx).Warning("Trust command called without reply")
+		return nil
+	}
+	scope, ok := trustScope(msg)
+	if !ok {
+		b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, "Usage: /trust [here]"))
+		return nil
+	}
+	toTrust := resolveSender(msg.ReplyToMessage)
+	if !toTrust.isAccountable() {
+		b.log(ctx).Warningf("Can't trust %s", toTrust)
+		return nil
+	}
+	if err := b.storage.TrustUser(toTrust.id, scope, fmt.Sprintf("trusted by %s", resolveSender(msg))); err != nil {
+		return fmt.Errorf("trusting user: %w", err)
+	}
+	b.log(ctx).Infof("Marked %s as trusted %s", toTrust, formatTrustScope(scope))
+	b.audit(ctx, b.chatSettings(msg.Chat.ID), storage.AuditEntry{
+		ChatID:  msg.Chat.ID,
+		Action:  "trust",
+		Target:  toTrust.String(),
+		Details: formatTrustScope(scope),
+	}, auditContext{
+		about: msg.ReplyToMessage,
+		undo:  []tgbotapi.InlineKeyboardButton{untrustButton(toTrust)},
+	})
+	return nil
+}
+
+// processUntrustCommand revokes the trust of the sender of the replied message everywhere,
+// or only in the chat with "here", so that the rules don't trust them again either.
+func (b *Bot) processUntrustCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	if msg.ReplyToMessage == nil {
+		b.log(ctx).Warning("Untrust command called without reply")
+		return nil
+	}
+	scope, ok := trustScope(msg)
+	if !ok {
+		b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, "Usage: /untrust [here]"))
+		return nil
+	}
+	toUntrust := resolveSender(msg.ReplyToMessage)
+	if !toUntrust.isAccountable() {
+		b.log(ctx).Warningf("Can't untrust %s", toUntrust)
+		return nil
+	}
+	if err := b.storage.UntrustUser(toUntrust.id, scope, fmt.Sprintf("revoked by %s", resolveSender(msg))); err != nil {
+		return fmt.Errorf("untrusting user: %w", err)
+	}
+	b.log(ctx).Infof("Revoked trust of %s %s", toUntrust, formatTrustScope(scope))
+	b.audit(ctx, b.chatSettings(msg.Chat.ID), storage.AuditEntry{
+		ChatID:  msg.Chat.ID,
+		Action:  "untrust",
+		Target:  toUntrust.String(),
+		Details: formatTrustScope(scope),
+	}, auditContext{
+		about: msg.ReplyToMessage,
+		undo:  []tgbotapi.InlineKeyboardButton{trustButton(toUntrust)},
+	})
+	return nil
+}
+
+// processTrustedCommand lists the members trusted in the chat, /trusted <page> shows the next pages.
+func (b *Bot) processTrustedCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	page := 1
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		var err error
+		if page, err = strconv.Atoi(arg); err != nil || page < 1 {
+			b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, "Usage: /trusted [page]"))
+			return nil
+		}
+	}
+	trusted, total, err := b.storage.GetTrustedUsers(msg.Chat.ID, (page-1)*trustedPageSize, trustedPageSize)
+	if err != nil {
+		return fmt.Errorf("getting trusted users: %w", err)
+	}
+	b.requestSend(ctx, tgbotapi.NewMessage(msg.Chat.ID, formatTrustedUsers(trusted, page, total)))
+	return nil
+}
+
+func formatTrustedUsers(trusted []storage.Trust, page int, total int) string {
+	if total == 0 {
+		return "Nobody is trusted"
+	}
+	pages := (total + trustedPageSize - 1) / trustedPageSize
+	if len(trusted) == 0 {
+		return fmt.Sprintf("There's no page %d, the last one is %d", page, pages)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Trusted members, page %d of %d:\n", page, pages)
+	for _, t := range trusted {
+		fmt.Fprintf(&sb, "\n%d %s since %s: %s", t.UserID, formatTrustScope(t.ChatID), t.Time.Format("2006-01-02"), t.Reason)
+	}
+	return sb.String()
+}
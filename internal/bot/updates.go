@@ -6,152 +6,314 @@ import (
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/sirupsen/logrus"
+	"github.com/pomo-mondreganto/goas/internal/storage"
 )
 
-func (b *Bot) processNewMembersMessage(msg *tgbotapi.Message) error {
-	b.logger.Info("Processing new members message")
+func (b *Bot) processNewMembersMessage(ctx context.Context, msg *tgbotapi.Message) error {
+	b.log(ctx).Info("Processing new members message")
 	for _, member := range msg.NewChatMembers {
 		if _, err := b.storage.GetOrSetUserFirstSeen(member.ID, time.Now()); err != nil {
 			return fmt.Errorf("setting user %d first seen: %w", member.ID, err)
 		}
 	}
-	b.logger.Info("Deleting new members message")
-	b.requestDelete(msg.Chat.ID, msg.MessageID)
+	b.log(ctx).Info("Deleting new members message")
+	b.requestDelete(ctx, msg.Chat.ID, msg.MessageID)
 	return nil
 }
 
-func (b *Bot) processMemberLeftMessage(msg *tgbotapi.Message) {
-	b.logger.Info("Deleting member left message")
-	b.requestDelete(msg.Chat.ID, msg.MessageID)
+func (b *Bot) processMemberLeftMessage(ctx context.Context, msg *tgbotapi.Message) {
+	b.log(ctx).Info("Deleting member left message")
+	b.requestDelete(ctx, msg.Chat.ID, msg.MessageID)
 }
 
 func (b *Bot) processChatMessage(ctx context.Context, msg *tgbotapi.Message) error {
-	b.logger.Info("Processing chat message")
+	from := resolveSender(msg)
+	b.log(ctx).Infof("Processing chat message from %s", from)
 
-	if _, err := b.storage.GetOrSetUserFirstSeen(msg.From.ID, time.Now()); err != nil {
-		return fmt.Errorf("getting user first seen: %w", err)
+	if msg.MediaGroupID != "" {
+		b.collectAlbumMessage(ctx, msg)
+		return nil
 	}
-	if _, err := b.storage.IncUserChatMessageCount(msg.From.ID, msg.Chat.ID, 1); err != nil {
-		return fmt.Errorf("incrementing message count: %w", err)
+
+	if err := b.recordSenderMessages(ctx, from, []*tgbotapi.Message{msg}); err != nil {
+		return err
 	}
 
 	if msg.IsCommand() {
-		b.logger.Infof("User %d sent command %s", msg.From.ID, msg.Command())
-		// Only admins can use commands.
-		if b.storage.IsUserAdmin(msg.From.ID) {
+		b.log(ctx).Infof("Sender %s sent command %s", from, msg.Command())
+		if msg.Command() == "report" {
+			// Anyone can report, the reporter is checked instead.
+			if err := b.processReport(ctx, msg); err != nil {
+				return fmt.Errorf("processing report: %w", err)
+			}
+		} else if from.kind == senderUser && b.storage.IsUserAdmin(from.id) {
+			// Only admins can use other commands.
 			switch msg.Command() {
 			case "trust":
-				if err := b.processTrustCommand(msg); err != nil {
+				if err := b.processTrustCommand(ctx, msg); err != nil {
 					return fmt.Errorf("processing trust command: %w", err)
 				}
+			case "untrust":
+				if err := b.processUntrustCommand(ctx, msg); err != nil {
+					return fmt.Errorf("processing untrust command: %w", err)
+				}
+			case "reputation":
+				if err := b.processReputationCommand(ctx, msg); err != nil {
+					return fmt.Errorf("processing reputation command: %w", err)
+				}
+			case "trusted":
+				if err := b.processTrustedCommand(ctx, msg); err != nil {
+					return fmt.Errorf("processing trusted command: %w", err)
+				}
 			case "ban":
-				b.processBanCommand(msg)
+				b.processBanCommand(ctx, msg)
+			case "warn":
+				b.processSanctionCommand(ctx, msg, sanctionWarn)
+			case "mute":
+				b.processSanctionCommand(ctx, msg, sanctionMute)
+			case "tban":
+				b.processSanctionCommand(ctx, msg, sanctionBan)
 			case "spam":
 				if err := b.processSpamCommand(ctx, msg); err != nil {
 					return fmt.Errorf("processing spam command: %w", err)
 				}
+			case "settings":
+				if err := b.processSettingsCommand(ctx, msg); err != nil {
+					return fmt.Errorf("processing settings command: %w", err)
+				}
+			case "notspam":
+				if err := b.processNotSpamCommand(ctx, msg); err != nil {
+					return fmt.Errorf("processing notspam command: %w", err)
+				}
 			}
 		}
-		b.logger.Info("Deleting command message in public chat")
-		b.requestDelete(msg.Chat.ID, msg.MessageID)
+		b.log(ctx).Info("Deleting command message in public chat")
+		b.requestDelete(ctx, msg.Chat.ID, msg.MessageID)
 		return nil
 	}
 
-	verdict, err := b.isChatMessageSuspicious(ctx, msg)
-	if err != nil {
-		return fmt.Errorf("checking suspicious message: %w", err)
+	if isAdminMention(msg) {
+		if err := b.processReport(ctx, msg); err != nil {
+			return fmt.Errorf("processing admin mention: %w", err)
+		}
+	}
+
+	return b.checkChatMessages(ctx, []*tgbotapi.Message{msg}, nil)
+}
+
+func (b *Bot) processAlbum(ctx context.Context, a *album) error {
+	msg := a.messages[0]
+	from := resolveSender(msg)
+	b.log(ctx).Infof("Processing album %s of %d messages from %s", a.id, len(a.messages), from)
+
+	if err := b.recordSenderMessages(ctx, from, a.messages); err != nil {
+		return err
 	}
 
-	if verdict == mightBeSpam {
-		b.processSuspiciousMessage(msg)
-	} else if verdict == definitelySpam {
-		b.processSpamMessage(msg)
+	ids := make([]int, 0, len(a.messages))
+	for _, m := range a.messages {
+		ids = append(ids, m.MessageID)
+	}
+	// Remember the whole album so that it can be deleted by any of its messages later.
+	if err := b.storage.AddAlbumMessages(msg.Chat.ID, a.id, ids, time.Now()); err != nil {
+		return fmt.Errorf("saving album messages: %w", err)
 	}
 
+	return b.checkChatMessages(ctx, a.messages, nil)
+}
+
+// recordSenderMessages does the bookkeeping for messages sent at once,
+// they are counted as a single message.
+func (b *Bot) recordSenderMessages(ctx context.Context, from sender, msgs []*tgbotapi.Message) error {
+	if !from.isAccountable() {
+		return nil
+	}
+	now := time.Now()
+	chatID := msgs[0].Chat.ID
+	if _, err := b.storage.GetOrSetUserFirstSeen(from.id, now); err != nil {
+		return fmt.Errorf("getting user first seen: %w", err)
+	}
+	if _, err := b.storage.IncUserChatMessageCount(from.id, chatID, 1); err != nil {
+		return fmt.Errorf("incrementing message count: %w", err)
+	}
+	for _, msg := range msgs {
+		if err := b.storage.AddUserChatMessage(
+			from.id,
+			chatID,
+			msg.MessageID,
+			now,
+			recentMessagesLimit,
+			recentMessagesWindow,
+		); err != nil {
+			return fmt.Errorf("saving recent message: %w", err)
+		}
+		b.rememberFingerprint(ctx, msg)
+	}
 	return nil
 }
 
-func (b *Bot) processTrustCommand(msg *tgbotapi.Message) error {
-	if msg.ReplyToMessage == nil {
-		b.logger.Warning("Trust command called without reply")
+// checkChatMessages runs the checks over messages that are judged together,
+// the first one is the message the verdict is attached to.
+// edit is what an edit added to the message, if it's edited.
+func (b *Bot) checkChatMessages(ctx context.Context, msgs []*tgbotapi.Message, edit *contentDiff) error {
+	settings := b.chatSettings(msgs[0].Chat.ID)
+	d, err := b.isChatMessageSuspicious(ctx, msgs, settings, edit)
+	if err != nil {
+		return fmt.Errorf("checking suspicious message: %w", err)
+	}
+	from := resolveSender(msgs[0])
+	if b.onVerdict != nil {
+		v := Verdict{
+			ChatID:  msgs[0].Chat.ID,
+			Sender:  from.String(),
+			Verdict: d.verdict.String(),
+		}
+		for _, m := range msgs {
+			v.MessageIDs = append(v.MessageIDs, m.MessageID)
+		}
+		b.onVerdict(v)
+	}
+	if d.verdict == notSpam {
+		if d.score == 0 && edit == nil {
+			b.earnReputation(ctx, from, msgs)
+		}
 		return nil
 	}
-	toTrust := msg.ReplyToMessage.From.ID
-	if err := b.storage.TrustUser(toTrust); err != nil {
-		return fmt.Errorf("trusting user: %w", err)
+
+	msg := msgs[0]
+	// Remember what matched, so that /notspam can undo it.
+	if err := b.storage.SaveDetection(msg.Chat.ID, msg.MessageID, storage.Detection{
+		Time:     time.Now(),
+		Sender:   from.kind.String(),
+		SenderID: from.id,
+		Verdict:  d.verdict.String(),
+		Reason:   d.reason,
+		Patterns: d.patterns,
+		Samples:  d.samples,
+		Photos:   largestPhotos(msgs),
+	}); err != nil {
+		return fmt.Errorf("saving detection: %w", err)
 	}
-	b.logger.Infof("Marked user %d as trusted", toTrust)
+
+	details := fmt.Sprintf("%s, message %d", d, msg.MessageID)
+	if edit != nil {
+		details = "edited, " + details
+	}
+	b.perform(ctx, settings, storage.AuditEntry{
+		ChatID:  msg.Chat.ID,
+		Action:  "vote",
+		Target:  from.String(),
+		Details: details,
+	}, auditContext{
+		about: msg,
+		undo:  []tgbotapi.InlineKeyboardButton{trustButton(from), allowButton(msg)},
+	}, func() {
+		if edit != nil {
+			updated, err := b.updateVotePrompt(ctx, msg, d)
+			if err != nil {
+				b.log(ctx).Errorf("Error updating vote prompt: %v", err)
+			}
+			if updated {
+				return
+			}
+		}
+		if d.verdict == mightBeSpam {
+			b.processSuspiciousMessage(ctx, msg)
+		} else if d.verdict == definitelySpam {
+			b.processSpamMessage(ctx, msg)
+		}
+	})
+
 	return nil
 }
 
-func (b *Bot) processBanCommand(msg *tgbotapi.Message) {
+func (b *Bot) processBanCommand(ctx context.Context, msg *tgbotapi.Message) {
 	if msg.ReplyToMessage == nil {
-		b.logger.Warning("Ban command called without reply")
+		b.log(ctx).Warning("Ban command called without reply")
 		return
 	}
-	b.banSender(msg.ReplyToMessage)
+	b.banSender(ctx, msg.ReplyToMessage)
 }
 
 func (b *Bot) processSpamCommand(ctx context.Context, msg *tgbotapi.Message) error {
 	if msg.ReplyToMessage == nil {
-		b.logger.Warning("Spam command called without reply")
+		b.log(ctx).Warning("Spam command called without reply")
 		return nil
 	}
 	reply := msg.ReplyToMessage
-	userID := reply.From.ID
-	if userID == b.api.Self.ID {
-		logrus.Warning("My messages are not spam")
+	from := resolveSender(reply)
+	if from.kind == senderUser && from.id == b.api.Self.ID {
+		b.log(ctx).Warning("My messages are not spam")
+		return nil
+	}
+	if !from.isAccountable() {
+		b.log(ctx).Warningf("Message from %s can't be spam", from)
 		return nil
 	}
 
-	b.logger.Infof("Received spam message from %d", userID)
-	for _, ps := range reply.Photo {
-		if err := b.addImageSample(ctx, ps.FileID); err != nil {
-			return fmt.Errorf("adding image sample: %w", err)
-		}
+	b.log(ctx).Infof("Received spam message from %s", from)
+	if err := b.learnSamples(ctx, reply); err != nil {
+		return fmt.Errorf("learning samples: %w", err)
 	}
-	b.banSender(reply)
+	b.punish(ctx, reply, nil)
 	return nil
 }
 
-func (b *Bot) processSuspiciousMessage(msg *tgbotapi.Message) {
-	m := getSpamVoteMessage(msg, "Is this message spam?")
-	b.logger.Info("Sending suspicious message notification")
-	b.requestSend(m)
+func (b *Bot) processSuspiciousMessage(ctx context.Context, msg *tgbotapi.Message) {
+	m := getSpamVoteMessage(msg, "Is this message spam?\n\n"+formatVoteTally(0, 0, b.voteQuorum(msg.Chat.ID)))
+	b.log(ctx).Info("Sending suspicious message notification")
+	b.requestSendThen(ctx, m, b.votePromptSent(ctx, msg))
 }
 
-func (b *Bot) processSpamMessage(msg *tgbotapi.Message) {
-	m := getSpamVoteMessage(msg, "This message looks like spam. Is it?")
+func (b *Bot) processSpamMessage(ctx context.Context, msg *tgbotapi.Message) {
+	m := getSpamVoteMessage(msg, "This message looks like spam. Is it?\n\n"+formatVoteTally(0, 0, b.voteQuorum(msg.Chat.ID)))
 	m.ParseMode = "markdown"
 	m.ReplyToMessageID = msg.MessageID
-	b.logger.Info("Sending spam message notification")
-	b.requestSend(m)
+	b.log(ctx).Info("Sending spam message notification")
+	b.requestSendThen(ctx, m, b.votePromptSent(ctx, msg))
 }
 
 func (b *Bot) processCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	b.logger.Debugf("Received callback: %+v", callback)
+	b.log(ctx).Debugf("Received callback %s with data %s from %s", callback.ID, callback.Data, b.redact.user(callback.From))
 	if callback.Message == nil {
-		b.logger.Warning("Callback without message, skipping")
+		b.log(ctx).Warning("Callback without message, skipping")
 		return nil
 	}
 	if callback.Message.Chat == nil {
-		b.logger.Warning("Callback not in chat, skipping")
-		return nil
-	}
-	if callback.Message.ReplyToMessage == nil {
-		b.logger.Warning("Callback message is not a reply, skipping")
+		b.log(ctx).Warning("Callback not in chat, skipping")
 		return nil
 	}
 	userID := callback.From.ID
 	chatID := callback.Message.Chat.ID
 	msgID := callback.Message.MessageID
-	reply := callback.Message.ReplyToMessage
-	b.logger.Debugf("User id: %d, Message ID: %d, reply: %#v", userID, msgID, reply)
+	reply, err := b.votedMessage(callback.Message)
+	if err != nil {
+		return fmt.Errorf("getting voted message: %w", err)
+	}
+	if reply == nil {
+		b.log(ctx).Warning("Callback message is not a reply, skipping")
+		return nil
+	}
+	b.log(ctx).Debugf("User id: %d, Message ID: %d, reply to message %d", userID, msgID, reply.MessageID)
 
 	vote := callback.Data == voteSpamCallback
 
-	if err := b.storage.VoteSpam(userID, chatID, msgID, vote); err != nil {
+	if suspect := resolveSender(reply); suspect.kind == senderUser && suspect.id == userID {
+		b.requestSend(ctx, tgbotapi.NewCallback(callback.ID, "You can't vote on your own message"))
+		return nil
+	}
+	weight := 1
+	if !b.storage.IsUserAdmin(userID) {
+		if weight, err = b.voterWeight(userID, chatID); err != nil {
+			return fmt.Errorf("getting voter weight: %w", err)
+		}
+	}
+	if weight == 0 {
+		b.requestSend(ctx, tgbotapi.NewCallback(callback.ID, "You can't vote yet"))
+		return nil
+	}
+
+	if err := b.storage.VoteSpam(userID, chatID, msgID, vote, weight); err != nil {
 		return fmt.Errorf("voting: %w", err)
 	}
 
@@ -160,26 +322,49 @@ func (b *Bot) processCallback(ctx context.Context, callback *tgbotapi.CallbackQu
 		return fmt.Errorf("getting votes: %w", err)
 	}
 
-	final, ban := b.checkVotes(votesFor, votesAgainst, userID, vote)
-	b.logger.Debugf("Verdict for vote: final=%t ban=%t", final, ban)
+	quorum := b.voteQuorum(chatID)
+	final, ban := b.checkVotes(votesFor, votesAgainst, quorum, userID, vote)
+	b.log(ctx).Debugf("Verdict for vote: final=%t ban=%t", final, ban)
 
 	if final {
-		defer b.requestDelete(chatID, msgID)
+		result := "keep"
+		if ban {
+			result = "ban"
+		}
+		b.audit(ctx, b.chatSettings(chatID), storage.AuditEntry{
+			ChatID:  chatID,
+			Action:  "vote_result",
+			Target:  resolveSender(reply).String(),
+			Details: fmt.Sprintf("%s with %d for, %d against, message %d", result, votesFor, votesAgainst, reply.MessageID),
+		}, auditContext{about: reply})
+		if err := b.settleReports(chatID, reply.MessageID, resolveSender(reply), ban); err != nil {
+			return fmt.Errorf("settling reports: %w", err)
+		}
+		restriction := b.takeRestriction(ctx, chatID, msgID)
+		if err := b.storage.ResolveVote(chatID, msgID); err != nil {
+			return fmt.Errorf("resolving vote: %w", err)
+		}
+
+		defer b.requestDelete(ctx, chatID, msgID)
 
 		if ban {
-			defer b.banSender(reply)
+			defer b.punish(ctx, reply, restriction)
 
-			b.logger.Infof("Decided to ban user with %d for, %d against votes", votesFor, votesAgainst)
+			b.log(ctx).Infof("Decided to ban user with %d for, %d against votes", votesFor, votesAgainst)
 			if len(reply.Photo) > 0 {
-				b.logger.Info("Adding photos as samples")
-				for _, ps := range reply.Photo {
-					if err := b.addImageSample(ctx, ps.FileID); err != nil {
-						return fmt.Errorf("adding image sample: %w", err)
-					}
+				b.log(ctx).Info("Adding photos as samples")
+				if err := b.learnSamples(ctx, reply); err != nil {
+					return fmt.Errorf("learning samples: %w", err)
 				}
 			}
 		} else {
-			b.logger.Infof("Decided not to ban user with %d for, %d against votes", votesFor, votesAgainst)
+			b.log(ctx).Infof("Decided not to ban user with %d for, %d against votes", votesFor, votesAgainst)
+			if suspect := resolveSender(reply); suspect.kind == senderUser {
+				if err := b.storage.AddPassedVote(chatID, suspect.id); err != nil {
+					return fmt.Errorf("adding passed vote: %w", err)
+				}
+			}
+			b.liftRestriction(ctx, restriction, "not spam", reply)
 		}
 	} else {
 		edit := tgbotapi.EditMessageTextConfig{
@@ -190,8 +375,8 @@ func (b *Bot) processCallback(ctx context.Context, callback *tgbotapi.CallbackQu
 			},
 			ParseMode: "markdown",
 		}
-		edit.Text = fmt.Sprintf("Is this spam?\n\nVotes `spam`: %d\n\nVotes `not spam`: %d", votesFor, votesAgainst)
-		b.requestSend(edit)
+		edit.Text = "Is this spam?\n\n" + formatVoteTally(votesFor, votesAgainst, quorum)
+		b.requestSend(ctx, edit)
 	}
 
 	return nil
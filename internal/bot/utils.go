@@ -1,15 +1,17 @@
 package bot
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
 )
 
 var (
@@ -18,31 +20,45 @@ var (
 )
 
 func (b *Bot) downloadImg(ctx context.Context, fileID string, saveTo io.Writer) (image.Image, error) {
-	url, err := b.api.GetFileDirectURL(fileID)
+	start := time.Now()
+	file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
 	if err != nil {
 		return nil, fmt.Errorf("getting file link: %w", err)
 	}
+	url := fmt.Sprintf(b.fileEndpoint, b.api.Token, file.FilePath)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating download request: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := b.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("downloaing image: %w", err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			b.logger.Errorf("Error closing response body: %v", err)
+			b.log(ctx).Errorf("Error closing response body: %v", err)
 		}
 	}()
 
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	metrics.ImageDownload.Observe(time.Since(start).Seconds())
+	if b.recorder != nil {
+		if err := b.recorder.RecordFile(fileID, data); err != nil {
+			b.log(ctx).Errorf("Error recording file: %v", err)
+		}
+	}
 	if saveTo != nil {
-		resp.Body = ioutil.NopCloser(io.TeeReader(resp.Body, saveTo))
+		if _, err := saveTo.Write(data); err != nil {
+			return nil, fmt.Errorf("saving image: %w", err)
+		}
 	}
 
-	img, err := jpeg.Decode(resp.Body)
+	img, err := imgmatch.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("decoding image: %w", err)
 	}
@@ -73,3 +89,26 @@ func getSpamVoteMessage(msg *tgbotapi.Message, content string) tgbotapi.MessageC
 	m.ReplyMarkup = getSpamVoteMarkup()
 	return m
 }
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// largestPhotos returns the file ids of the largest size of each photo.
+func largestPhotos(msgs []*tgbotapi.Message) []string {
+	var fileIDs []string
+	for _, msg := range msgs {
+		if len(msg.Photo) > 0 {
+			fileIDs = append(fileIDs, msg.Photo[len(msg.Photo)-1].FileID)
+		}
+	}
+	return fileIDs
+}
@@ -0,0 +1,345 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pomo-mondreganto/goas/internal/metrics"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+const (
+	defaultVoteTimeout = 24 * time.Hour
+	voteSweepInterval  = time.Minute
+	voteGCInterval     = time.Hour
+
+	// How long the records are kept for, detections are needed for /notspam.
+	detectionTTL  = 30 * 24 * time.Hour
+	albumTTL      = 7 * 24 * time.Hour
+	reportTTL     = 7 * 24 * time.Hour
+	deadLetterTTL = 30 * 24 * time.Hour
+
+	// The most weight a single voter has.
+	maxVoterWeight = 3
+	// The quorum is the weight either side needs to decide,
+	// it grows by one for every membersPerQuorumVote members.
+	// It's bigger than a single vote, so that nobody but an admin decides alone.
+	minVoteQuorum        = maxVoterWeight + 1
+	maxVoteQuorum        = 15
+	membersPerQuorumVote = 100
+	memberCountTTL       = time.Hour
+)
+
+type memberCount struct {
+	count int
+	at    time.Time
+	// refreshing is set while the count is being fetched.
+	refreshing bool
+}
+
+// Rules to resolve expired votes by.
+const (
+	voteExpiryKeep     = "keep"
+	voteExpiryMajority = "majority"
+	voteExpiryDelete   = "delete"
+)
+
+var voteExpiryRules = []string{voteExpiryKeep, voteExpiryMajority, voteExpiryDelete}
+
+// voterWeight grows with the voter's reputation, it's zero if they can't vote.
+func (b *Bot) voterWeight(userID int64, chatID int64) (int, error) {
+	score, _, err := b.reputation(userID, chatID)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case score >= trustedReputation:
+		return maxVoterWeight, nil
+	case score >= reputableReputation:
+		return 2, nil
+	case score >= minVoterReputation:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// voteQuorum scales with the chat size, falling back to the minimum if it's unknown.
+// A stale member count is used until it's refreshed in the background.
+func (b *Bot) voteQuorum(chatID int64) int {
+	b.memberCountsMu.Lock()
+	cached := b.memberCounts[chatID]
+	if !cached.refreshing && time.Since(cached.at) > memberCountTTL {
+		select {
+		case b.refreshCounts <- chatID:
+			cached.refreshing = true
+			b.memberCounts[chatID] = cached
+		default:
+		}
+	}
+	b.memberCountsMu.Unlock()
+
+	quorum := minVoteQuorum + cached.count/membersPerQuorumVote
+	if quorum > maxVoteQuorum {
+		quorum = maxVoteQuorum
+	}
+	return quorum
+}
+
+// refreshMemberCounts fetches the member counts voteQuorum asks for, respecting the rate limit.
+func (b *Bot) refreshMemberCounts(ctx context.Context) {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case chatID := <-b.refreshCounts:
+			if wait := b.globalLimit.reserve(time.Now()); wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					return
+				}
+			}
+			count, err := b.api.GetChatMembersCount(tgbotapi.ChatMemberCountConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: chatID}})
+
+			b.memberCountsMu.Lock()
+			cached := b.memberCounts[chatID]
+			cached.refreshing = false
+			if err != nil {
+				b.logger.Errorf("Error getting chat %d member count: %v", chatID, err)
+			} else {
+				cached.count, cached.at = count, time.Now()
+			}
+			b.memberCounts[chatID] = cached
+			b.memberCountsMu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func formatVoteTally(votesFor, votesAgainst, quorum int) string {
+	remaining := quorum - votesFor
+	if votesAgainst > votesFor {
+		remaining = quorum - votesAgainst
+	}
+	return fmt.Sprintf("Votes `spam`: %d\n\nVotes `not spam`: %d\n\nNeeded to decide: %d more", votesFor, votesAgainst, remaining)
+}
+
+func voteTimeout(settings storage.ChatSettings) time.Duration {
+	if settings.VoteTimeout > 0 {
+		return settings.VoteTimeout
+	}
+	return defaultVoteTimeout
+}
+
+func voteExpiry(settings storage.ChatSettings) string {
+	if settings.VoteExpiry != "" {
+		return settings.VoteExpiry
+	}
+	return voteExpiryKeep
+}
+
+// votePromptSent remembers the prompt about the message once it's sent, and starts its deadline.
+func (b *Bot) votePromptSent(ctx context.Context, msg *tgbotapi.Message) func(*tgbotapi.Message) {
+	rememberAlert := b.rememberAlert(ctx, msg)
+	return func(prompt *tgbotapi.Message) {
+		rememberAlert(prompt)
+		metrics.Actions.WithLabelValues("vote").Inc()
+		if prompt == nil {
+			metrics.ActionFailures.WithLabelValues("vote").Inc()
+			return
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			b.log(ctx).Errorf("Error serializing voted message: %v", err)
+			return
+		}
+		settings := b.chatSettings(msg.Chat.ID)
+		deadline := time.Now().Add(voteTimeout(settings))
+		if err := b.storage.AddPendingVote(storage.PendingVote{
+			ChatID:   msg.Chat.ID,
+			PromptID: prompt.MessageID,
+			Deadline: deadline,
+			Message:  data,
+		}); err != nil {
+			b.log(ctx).Errorf("Error saving pending vote: %v", err)
+			return
+		}
+		if err := b.storage.SetVotePrompt(msg.Chat.ID, msg.MessageID, prompt.MessageID); err != nil {
+			b.log(ctx).Errorf("Error saving vote prompt: %v", err)
+		}
+		b.restrictSuspect(ctx, settings, msg, prompt.MessageID, deadline)
+	}
+}
+
+// votedMessage returns the message the prompt is about, falling back to the saved
+// one if it's hidden, or nil if the prompt isn't about a message.
+func (b *Bot) votedMessage(prompt *tgbotapi.Message) (*tgbotapi.Message, error) {
+	if prompt.ReplyToMessage != nil {
+		return prompt.ReplyToMessage, nil
+	}
+	pending, err := b.storage.GetPendingVote(prompt.Chat.ID, prompt.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("getting pending vote: %w", err)
+	}
+	if pending == nil {
+		return nil, nil
+	}
+	var msg tgbotapi.Message
+	if err := json.Unmarshal(pending.Message, &msg); err != nil {
+		return nil, fmt.Errorf("parsing voted message: %w", err)
+	}
+	return &msg, nil
+}
+
+// sweepVotes expires the votes past their deadlines, including the ones
+// left from before a restart, releases the suspects of the votes that are gone
+// and collects the stale votes and the old records.
+func (b *Bot) sweepVotes(ctx context.Context) {
+	defer b.wg.Done()
+
+	sweep := time.NewTicker(voteSweepInterval)
+	defer sweep.Stop()
+	gc := time.NewTicker(voteGCInterval)
+	defer gc.Stop()
+
+	b.expireVotes(ctx)
+	b.releaseRestrictions(withCorrelationID(ctx))
+	b.collectGarbage()
+	for {
+		select {
+		case <-sweep.C:
+			b.expireVotes(ctx)
+			b.releaseRestrictions(withCorrelationID(ctx))
+		case <-gc.C:
+			b.collectGarbage()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expireVotes hands the expired votes over to the chat workers, so that they don't race with the voting.
+func (b *Bot) expireVotes(ctx context.Context) {
+	votes, err := b.storage.GetPendingVotes()
+	if err != nil {
+		b.log(ctx).Errorf("Error getting pending votes: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range votes {
+		if votes[i].Deadline.After(now) {
+			continue
+		}
+		select {
+		case b.expiredVotes <- &votes[i]:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Bot) collectGarbage() {
+	b.collectStaleVotes()
+	now := time.Now()
+	for _, c := range []struct {
+		what   string
+		ttl    time.Duration
+		delete func(before time.Time) (int, error)
+	}{
+		{"fingerprints", fingerprintTTL, b.storage.DeleteFingerprintsBefore},
+		{"detections", detectionTTL, b.storage.DeleteDetectionsBefore},
+		{"albums", albumTTL, b.storage.DeleteAlbumsBefore},
+		{"reported messages", reportTTL, b.storage.DeleteReportsBefore},
+		{"dead letters", deadLetterTTL, b.storage.DeleteDeadLettersBefore},
+		{"mutes", 0, b.storage.DeleteMutesBefore},
+	} {
+		deleted, err := c.delete(now.Add(-c.ttl))
+		if err != nil {
+			b.logger.Errorf("Error deleting old %s: %v", c.what, err)
+			continue
+		}
+		if deleted > 0 {
+			b.logger.Infof("Deleted %d old %s", deleted, c.what)
+		}
+	}
+}
+
+func (b *Bot) collectStaleVotes() {
+	deleted, err := b.storage.DeleteStaleVotes()
+	if err != nil {
+		b.logger.Errorf("Error deleting stale votes: %v", err)
+		return
+	}
+	if deleted > 0 {
+		b.logger.Infof("Deleted %d stale votes", deleted)
+	}
+}
+
+func (b *Bot) processExpiredVote(ctx context.Context, vote *storage.PendingVote) error {
+	// The vote could have finished while waiting for the worker.
+	pending, err := b.storage.GetPendingVote(vote.ChatID, vote.PromptID)
+	if err != nil {
+		return fmt.Errorf("getting pending vote: %w", err)
+	}
+	if pending == nil {
+		return nil
+	}
+	var msg tgbotapi.Message
+	if err := json.Unmarshal(pending.Message, &msg); err != nil {
+		return fmt.Errorf("parsing voted message: %w", err)
+	}
+
+	votesFor, votesAgainst, err := b.storage.GetVotes(vote.ChatID, vote.PromptID)
+	if err != nil {
+		return fmt.Errorf("getting votes: %w", err)
+	}
+	settings := b.chatSettings(vote.ChatID)
+	rule := voteExpiry(settings)
+	result := voteExpiryKeep
+	switch {
+	case rule == voteExpiryMajority && votesFor > votesAgainst:
+		result = "ban"
+	case rule == voteExpiryDelete:
+		result = voteExpiryDelete
+	}
+
+	b.log(ctx).Infof("Vote %d expired with %d for, %d against votes, resolved by %s: %s", vote.PromptID, votesFor, votesAgainst, rule, result)
+	b.audit(ctx, settings, storage.AuditEntry{
+		ChatID:  vote.ChatID,
+		Action:  "vote_expired",
+		Target:  resolveSender(&msg).String(),
+		Details: fmt.Sprintf("%s by %s with %d for, %d against, message %d", result, rule, votesFor, votesAgainst, msg.MessageID),
+	}, auditContext{about: &msg})
+	restriction := b.takeRestriction(ctx, vote.ChatID, vote.PromptID)
+	if err := b.storage.ResolveVote(vote.ChatID, vote.PromptID); err != nil {
+		return fmt.Errorf("resolving vote: %w", err)
+	}
+	if err := b.settleReports(vote.ChatID, msg.MessageID, resolveSender(&msg), result != voteExpiryKeep); err != nil {
+		return fmt.Errorf("settling reports: %w", err)
+	}
+
+	edit := tgbotapi.NewEditMessageText(
+		vote.ChatID,
+		vote.PromptID,
+		fmt.Sprintf("Vote expired with %d spam, %d not spam votes, message: %s", votesFor, votesAgainst, result),
+	)
+	b.requestSend(ctx, edit)
+
+	switch result {
+	case "ban":
+		b.punish(ctx, &msg, restriction)
+	case voteExpiryDelete:
+		b.liftRestriction(ctx, restriction, "vote expired", nil)
+		b.requestDelete(ctx, vote.ChatID, msg.MessageID)
+	default:
+		b.liftRestriction(ctx, restriction, "vote expired", &msg)
+	}
+	return nil
+}
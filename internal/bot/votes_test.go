@@ -0,0 +1,20 @@
+package bot
+
+import "testing"
+
+func TestVoteQuorumRefreshesInBackground(t *testing.T) {
+	b := newUnitBot(t)
+	b.memberCounts = make(map[int64]memberCount)
+	b.refreshCounts = make(chan int64, 1)
+
+	// The bot isn't connected, so asking the API right away would fail.
+	if q := b.voteQuorum(testChatID); q != minVoteQuorum {
+		t.Fatalf("got quorum %d for an unknown chat, expected %d", q, minVoteQuorum)
+	}
+	if q := b.voteQuorum(testChatID); q != minVoteQuorum {
+		t.Fatalf("got quorum %d for an unknown chat, expected %d", q, minVoteQuorum)
+	}
+	if len(b.refreshCounts) != 1 || <-b.refreshCounts != testChatID {
+		t.Fatal("expected a single refresh of the chat")
+	}
+}
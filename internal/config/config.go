@@ -1,10 +1,14 @@
 package config
 
 import (
+	"net/http"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+const redactedSecret = "<redacted>"
+
 type Config struct {
 	LogLevel             string `mapstructure:"log_level"`
 	Debug                bool   `mapstructure:"debug"`
@@ -14,6 +18,17 @@ type Config struct {
 	Dictionary           string `mapstructure:"dictionary"`
 	InterestingThreshold int    `mapstructure:"interesting_threshold"`
 	SuspiciousThreshold  int    `mapstructure:"suspicious_threshold"`
+	APIEndpoint          string `mapstructure:"api_endpoint"`
+	Record               string `mapstructure:"record"`
+	MetricsAddr          string `mapstructure:"metrics_addr"`
+	LogRedactContent     bool   `mapstructure:"log_redact_content"`
+	LogRedactNames       bool   `mapstructure:"log_redact_names"`
+
+	DashboardAddr   string   `mapstructure:"dashboard_addr"`
+	DashboardTokens []string `mapstructure:"dashboard_tokens"`
+
+	// HTTPClient is used for all Telegram requests if set.
+	HTTPClient *http.Client `mapstructure:"-"`
 }
 
 func Get() *Config {
@@ -21,6 +36,19 @@ func Get() *Config {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		logrus.Fatalf("Error unmarshalling config: %v", err)
 	}
-	logrus.Debugf("Got config: %+v", cfg)
+	logrus.Debugf("Got config: %+v", cfg.redacted())
 	return &cfg
 }
+
+// redacted returns a copy of the config without the secrets, for logging.
+func (c Config) redacted() Config {
+	if c.Token != "" {
+		c.Token = redactedSecret
+	}
+	tokens := make([]string, len(c.DashboardTokens))
+	for i := range tokens {
+		tokens[i] = redactedSecret
+	}
+	c.DashboardTokens = tokens
+	return c
+}
@@ -0,0 +1,316 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pomo-mondreganto/goas/internal/library"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+var errNotFound = errors.New("not found")
+
+// badRequest errors are the client's fault, others are reported as internal errors.
+type badRequest struct{ error }
+
+// apiFunc returns the response to serialize.
+type apiFunc func(r *http.Request, args []string) (interface{}, error)
+
+type route struct {
+	// pattern is the path split by slashes, "*" matches any segment and is passed as an argument.
+	pattern []string
+	handle  apiFunc
+}
+
+func (s *Server) apiRoutes() http.Handler {
+	routes := []route{
+		{[]string{"me"}, s.getMe},
+		{[]string{"chats"}, s.getChats},
+		{[]string{"chats", "*", "audit"}, s.getChatAudit},
+		{[]string{"users"}, s.getUsers},
+		{[]string{"users", "*"}, s.getUser},
+		{[]string{"detections"}, s.getDetections},
+		{[]string{"votes"}, s.getVotes},
+		{[]string{"samples"}, s.getSamples},
+		{[]string{"banlist"}, s.getBanlist},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		// Thumbnails aren't JSON.
+		if len(segments) == 3 && segments[0] == "samples" && segments[2] == "thumbnail" {
+			s.serveThumbnail(w, segments[1])
+			return
+		}
+		for _, rt := range routes {
+			args, ok := matchRoute(rt.pattern, segments)
+			if !ok {
+				continue
+			}
+			result, err := rt.handle(r, args)
+			var br badRequest
+			switch {
+			case err == nil:
+				writeJSON(w, http.StatusOK, result)
+			case errors.Is(err, errNotFound):
+				writeError(w, http.StatusNotFound, err)
+			case errors.As(err, &br):
+				writeError(w, http.StatusBadRequest, err)
+			default:
+				logrus.Errorf("Error serving %s: %v", r.URL.Path, err)
+				writeError(w, http.StatusInternalServerError, fmt.Errorf("internal error"))
+			}
+			return
+		}
+		writeError(w, http.StatusNotFound, errNotFound)
+	})
+}
+
+func matchRoute(pattern, segments []string) ([]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var args []string
+	for i, p := range pattern {
+		if p == "*" {
+			args = append(args, segments[i])
+		} else if p != segments[i] {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("Error writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func queryInt(r *http.Request, name string, def int64) (int64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, badRequest{fmt.Errorf("invalid %s %q", name, value)}
+	}
+	return i, nil
+}
+
+// page parses offset and limit, the limit is capped.
+func page(r *http.Request) (offset int, limit int, err error) {
+	o, err := queryInt(r, "offset", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := queryInt(r, "limit", defaultLimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	if o < 0 || l < 1 {
+		return 0, 0, badRequest{fmt.Errorf("offset must be non-negative and limit positive")}
+	}
+	if l > maxLimit {
+		l = maxLimit
+	}
+	return int(o), int(l), nil
+}
+
+func parseID(value string) (int64, error) {
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, badRequest{fmt.Errorf("invalid id %q", value)}
+	}
+	return id, nil
+}
+
+func (s *Server) getMe(r *http.Request, _ []string) (interface{}, error) {
+	subject, _ := r.Context().Value(subjectKey{}).(string)
+	return map[string]string{"subject": subject}, nil
+}
+
+func (s *Server) getChats(*http.Request, []string) (interface{}, error) {
+	chats, err := s.storage.GetChats()
+	if err != nil {
+		return nil, fmt.Errorf("getting chats: %w", err)
+	}
+	return map[string]interface{}{"chats": chats}, nil
+}
+
+func (s *Server) getChatAudit(r *http.Request, args []string) (interface{}, error) {
+	chatID, err := parseID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	_, limit, err := page(r)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.storage.GetAuditEntries(chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getting audit entries: %w", err)
+	}
+	return map[string]interface{}{"entries": entries}, nil
+}
+
+type usersPage struct {
+	Total int                   `json:"total"`
+	Users []storage.UserSummary `json:"users"`
+}
+
+func (s *Server) getUsers(r *http.Request, _ []string) (interface{}, error) {
+	chatID, err := queryInt(r, "chat", 0)
+	if err != nil {
+		return nil, err
+	}
+	offset, limit, err := page(r)
+	if err != nil {
+		return nil, err
+	}
+	users, total, err := s.storage.GetUsers(chatID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getting users: %w", err)
+	}
+	return usersPage{Total: total, Users: users}, nil
+}
+
+type userDetails struct {
+	ID   int64             `json:"id"`
+	Data map[string]string `json:"data"`
+	// Trust and Reputation are in the chat given by the query, or global.
+	Trust      *storage.Trust      `json:"trust"`
+	Reputation *storage.Reputation `json:"reputation,omitempty"`
+}
+
+func (s *Server) getUser(r *http.Request, args []string) (interface{}, error) {
+	userID, err := parseID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	chatID, err := queryInt(r, "chat", 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.storage.GetUserData(userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting user data: %w", err)
+	}
+	trust, err := s.storage.GetTrust(userID, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("getting trust: %w", err)
+	}
+	if len(data) == 0 && trust == nil {
+		return nil, fmt.Errorf("user %d %w", userID, errNotFound)
+	}
+	u := userDetails{ID: userID, Data: data, Trust: trust}
+	if chatID != 0 {
+		rep, found, err := s.storage.GetReputation(chatID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("getting reputation: %w", err)
+		}
+		if found {
+			u.Reputation = &rep
+		}
+	}
+	return u, nil
+}
+
+func (s *Server) getDetections(r *http.Request, _ []string) (interface{}, error) {
+	chatID, err := queryInt(r, "chat", 0)
+	if err != nil {
+		return nil, err
+	}
+	_, limit, err := page(r)
+	if err != nil {
+		return nil, err
+	}
+	detections, err := s.storage.GetRecentDetections(chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("getting detections: %w", err)
+	}
+	return map[string]interface{}{"detections": detections}, nil
+}
+
+type openVote struct {
+	storage.PendingVote
+	VotesFor     int `json:"votes_for"`
+	VotesAgainst int `json:"votes_against"`
+}
+
+func (s *Server) getVotes(r *http.Request, _ []string) (interface{}, error) {
+	chatID, err := queryInt(r, "chat", 0)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.storage.GetPendingVotes()
+	if err != nil {
+		return nil, fmt.Errorf("getting pending votes: %w", err)
+	}
+	votes := make([]openVote, 0, len(pending))
+	for _, p := range pending {
+		if chatID != 0 && p.ChatID != chatID {
+			continue
+		}
+		v := openVote{PendingVote: p}
+		if v.VotesFor, v.VotesAgainst, err = s.storage.GetVotes(p.ChatID, p.PromptID); err != nil {
+			return nil, fmt.Errorf("getting votes: %w", err)
+		}
+		votes = append(votes, v)
+	}
+	return map[string]interface{}{"votes": votes}, nil
+}
+
+type sampleInfo struct {
+	library.Sample
+	// Loaded is false for the files the matcher skipped, e.g. too close to another sample.
+	Loaded bool `json:"loaded"`
+}
+
+func (s *Server) getSamples(*http.Request, []string) (interface{}, error) {
+	stats, err := s.storage.GetSampleStats()
+	if err != nil {
+		return nil, fmt.Errorf("getting sample stats: %w", err)
+	}
+	files, err := library.List(s.samplesDir, stats)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]bool)
+	for _, name := range s.imgMatcher.Samples() {
+		loaded[name] = true
+	}
+	samples := make([]sampleInfo, 0, len(files))
+	for _, f := range files {
+		samples = append(samples, sampleInfo{Sample: f, Loaded: loaded[f.Name]})
+	}
+	return map[string]interface{}{
+		"samples":   samples,
+		"allowlist": s.imgMatcher.Allowlist(),
+	}, nil
+}
+
+func (s *Server) getBanlist(*http.Request, []string) (interface{}, error) {
+	return map[string]interface{}{"patterns": s.banlist.Patterns()}, nil
+}
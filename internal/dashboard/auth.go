@@ -0,0 +1,164 @@
+package dashboard
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie = "goas_session"
+	sessionTTL    = 24 * time.Hour
+	// Telegram logins older than this are rejected, so that a leaked login link expires.
+	loginTTL = 24 * time.Hour
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// authenticator accepts static tokens and Telegram logins of bot admins,
+// the sessions are cookies signed with a key derived from the bot token.
+type authenticator struct {
+	botToken   string
+	tokens     []string
+	isAdmin    func(userID int64) bool
+	sessionKey []byte
+}
+
+func newAuthenticator(botToken string, tokens []string, isAdmin func(int64) bool) *authenticator {
+	key := sha256.Sum256([]byte("goas dashboard session\x00" + botToken))
+	var nonEmpty []string
+	for _, t := range tokens {
+		if t = strings.TrimSpace(t); t != "" {
+			nonEmpty = append(nonEmpty, t)
+		}
+	}
+	return &authenticator{
+		botToken:   botToken,
+		tokens:     nonEmpty,
+		isAdmin:    isAdmin,
+		sessionKey: key[:],
+	}
+}
+
+// authenticate returns who made the request, either with a bearer token or a session cookie.
+func (a *authenticator) authenticate(r *http.Request) (string, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		token := strings.TrimPrefix(h, "Bearer ")
+		if token == h || !a.checkToken(token) {
+			return "", errUnauthorized
+		}
+		return "token", nil
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", errUnauthorized
+	}
+	return a.checkSession(c.Value, time.Now())
+}
+
+func (a *authenticator) checkToken(token string) bool {
+	ok := false
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// checkTelegramLogin verifies the data of the Telegram Login Widget and returns the user ID,
+// see https://core.telegram.org/widgets/login#checking-authorization.
+func (a *authenticator) checkTelegramLogin(values url.Values, now time.Time) (int64, error) {
+	hash := values.Get("hash")
+	if hash == "" {
+		return 0, fmt.Errorf("no hash")
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k != "hash" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+"="+values.Get(k))
+	}
+
+	secret := sha256.Sum256([]byte(a.botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return 0, fmt.Errorf("invalid hash")
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid auth date: %w", err)
+	}
+	if now.Sub(time.Unix(authDate, 0)) > loginTTL {
+		return 0, fmt.Errorf("login expired")
+	}
+	userID, err := strconv.ParseInt(values.Get("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id: %w", err)
+	}
+	if !a.isAdmin(userID) {
+		return 0, fmt.Errorf("user %d is not an admin", userID)
+	}
+	return userID, nil
+}
+
+// newSession returns the cookie value for the subject, "<subject>.<expiry>.<signature>".
+func (a *authenticator) newSession(subject string, now time.Time) string {
+	payload := fmt.Sprintf("%s.%d", subject, now.Add(sessionTTL).Unix())
+	return payload + "." + a.sign(payload)
+}
+
+func (a *authenticator) checkSession(value string, now time.Time) (string, error) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return "", errUnauthorized
+	}
+	payload, signature := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(a.sign(payload)), []byte(signature)) {
+		return "", errUnauthorized
+	}
+	j := strings.LastIndex(payload, ".")
+	if j < 0 {
+		return "", errUnauthorized
+	}
+	expiry, err := strconv.ParseInt(payload[j+1:], 10, 64)
+	if err != nil || now.After(time.Unix(expiry, 0)) {
+		return "", errUnauthorized
+	}
+	return payload[:j], nil
+}
+
+func (a *authenticator) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
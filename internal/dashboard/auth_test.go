@@ -0,0 +1,147 @@
+package dashboard
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testBotToken = "123:TOKEN"
+	testAdminID  = 143994885
+)
+
+func newTestAuthenticator() *authenticator {
+	return newAuthenticator(testBotToken, []string{"static"}, func(userID int64) bool {
+		return userID == testAdminID
+	})
+}
+
+// loginValues returns the login widget data signed with the bot token.
+func loginValues(userID int64, authDate time.Time) url.Values {
+	values := url.Values{
+		"id":         {strconv.FormatInt(userID, 10)},
+		"first_name": {"admin"},
+		"auth_date":  {strconv.FormatInt(authDate.Unix(), 10)},
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, k+"="+values.Get(k))
+	}
+	secret := sha256.Sum256([]byte(testBotToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return values
+}
+
+func TestCheckTelegramLogin(t *testing.T) {
+	a := newTestAuthenticator()
+	now := time.Now()
+	for _, tc := range []struct {
+		name   string
+		values func() url.Values
+		ok     bool
+	}{
+		{
+			name:   "admin",
+			values: func() url.Values { return loginValues(testAdminID, now.Add(-time.Minute)) },
+			ok:     true,
+		},
+		{
+			name: "no hash",
+			values: func() url.Values {
+				v := loginValues(testAdminID, now)
+				v.Del("hash")
+				return v
+			},
+		},
+		{
+			name: "bad hash",
+			values: func() url.Values {
+				v := loginValues(testAdminID, now)
+				v.Set("hash", strings.Repeat("0", 64))
+				return v
+			},
+		},
+		{
+			name: "tampered data",
+			values: func() url.Values {
+				v := loginValues(42, now)
+				v.Set("id", strconv.Itoa(testAdminID))
+				return v
+			},
+		},
+		{
+			name:   "expired auth date",
+			values: func() url.Values { return loginValues(testAdminID, now.Add(-loginTTL-time.Minute)) },
+		},
+		{
+			name:   "not an admin",
+			values: func() url.Values { return loginValues(42, now) },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			userID, err := a.checkTelegramLogin(tc.values(), now)
+			if tc.ok {
+				if err != nil {
+					t.Fatalf("checking login: %v", err)
+				}
+				if userID != testAdminID {
+					t.Fatalf("got user %d, expected %d", userID, testAdminID)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("accepted login of user %d", userID)
+			}
+		})
+	}
+}
+
+func TestCheckSession(t *testing.T) {
+	a := newTestAuthenticator()
+	now := time.Now()
+	session := a.newSession("user:143994885", now)
+	payload, signature := session[:strings.LastIndex(session, ".")], session[strings.LastIndex(session, ".")+1:]
+	for _, tc := range []struct {
+		name  string
+		value string
+		at    time.Time
+		ok    bool
+	}{
+		{name: "valid", value: session, at: now.Add(time.Hour), ok: true},
+		{name: "tampered signature", value: payload + "." + strings.Repeat("0", len(signature)), at: now},
+		{name: "tampered subject", value: strings.Replace(payload, "143994885", "42", 1) + "." + signature, at: now},
+		{name: "other key", value: newAuthenticator("456:OTHER", nil, nil).newSession("user:143994885", now), at: now},
+		{name: "expired", value: session, at: now.Add(sessionTTL + time.Minute)},
+		{name: "malformed", value: "garbage", at: now},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			subject, err := a.checkSession(tc.value, tc.at)
+			if tc.ok {
+				if err != nil {
+					t.Fatalf("checking session: %v", err)
+				}
+				if subject != "user:143994885" {
+					t.Fatalf("got subject %q, expected user:143994885", subject)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("accepted session of %q", subject)
+			}
+		})
+	}
+}
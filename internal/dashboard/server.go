@@ -0,0 +1,179 @@
+// Package dashboard serves the read-only admin dashboard and its JSON API.
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/pomo-mondreganto/goas/internal/banlist"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+//go:embed ui
+var ui embed.FS
+
+// Config is what the dashboard needs to know about the bot.
+type Config struct {
+	Addr string
+	// Tokens are the static API tokens.
+	Tokens []string
+	// BotToken checks the Telegram logins and signs the sessions.
+	BotToken string
+	// BotUserName is shown in the Telegram Login Widget.
+	BotUserName string
+	SamplesDir  string
+}
+
+type Server struct {
+	srv        *http.Server
+	storage    *storage.Storage
+	imgMatcher *imgmatch.Matcher
+	banlist    *banlist.BanList
+	samplesDir string
+	botName    string
+	auth       *authenticator
+	thumbnails *thumbnailCache
+}
+
+func New(cfg Config, s *storage.Storage, m *imgmatch.Matcher, l *banlist.BanList) *Server {
+	srv := &Server{
+		storage:    s,
+		imgMatcher: m,
+		banlist:    l,
+		samplesDir: cfg.SamplesDir,
+		botName:    cfg.BotUserName,
+		auth:       newAuthenticator(cfg.BotToken, cfg.Tokens, s.IsUserAdmin),
+		thumbnails: newThumbnailCache(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", srv.handleIndex)
+	mux.HandleFunc("/login", srv.handleLogin)
+	mux.HandleFunc("/auth/telegram", srv.handleTelegramLogin)
+	mux.HandleFunc("/auth/token", srv.handleTokenLogin)
+	mux.HandleFunc("/auth/logout", srv.handleLogout)
+	mux.Handle("/api/v1/", srv.requireAuth(http.StripPrefix("/api/v1", srv.apiRoutes())))
+
+	srv.srv = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv
+}
+
+// Run serves until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.srv.ListenAndServe()
+	}()
+	logrus.Infof("Serving dashboard on %s", s.srv.Addr)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("serving dashboard: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down dashboard: %w", err)
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving dashboard: %w", err)
+	}
+	return nil
+}
+
+type subjectKey struct{}
+
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, err := s.auth.authenticate(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), subjectKey{}, subject)))
+	})
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := s.auth.authenticate(r); err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	page, err := ui.ReadFile("ui/index.html")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(page)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	page, err := ui.ReadFile("ui/login.html")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	tmpl, err := template.New("login").Parse(string(page))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct{ BotName, Error string }{s.botName, r.URL.Query().Get("error")}
+	if err := tmpl.Execute(w, data); err != nil {
+		logrus.Errorf("Error rendering login page: %v", err)
+	}
+}
+
+// handleTelegramLogin is the auth URL of the Telegram Login Widget.
+func (s *Server) handleTelegramLogin(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.auth.checkTelegramLogin(r.URL.Query(), time.Now())
+	if err != nil {
+		logrus.Warningf("Rejected dashboard login: %v", err)
+		http.Redirect(w, r, "/login?error=login+rejected", http.StatusFound)
+		return
+	}
+	logrus.Infof("User %d logged in to the dashboard", userID)
+	setSessionCookie(w, r, s.auth.newSession(fmt.Sprintf("user:%d", userID), time.Now()), int(sessionTTL.Seconds()))
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (s *Server) handleTokenLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	if !s.auth.checkToken(r.PostFormValue("token")) {
+		logrus.Warning("Rejected dashboard login with an invalid token")
+		http.Redirect(w, r, "/login?error=invalid+token", http.StatusFound)
+		return
+	}
+	setSessionCookie(w, r, s.auth.newSession("token", time.Now()), int(sessionTTL.Seconds()))
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	setSessionCookie(w, r, "", -1)
+	http.Redirect(w, r, "/login", http.StatusFound)
+}
@@ -0,0 +1,68 @@
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nfnt/resize"
+	"github.com/pomo-mondreganto/goas/internal/imgmatch"
+	"github.com/pomo-mondreganto/goas/internal/library"
+	"github.com/sirupsen/logrus"
+)
+
+const thumbnailSize = 160
+
+// thumbnailCache keeps the thumbnails of the samples, the sample files don't change once added.
+type thumbnailCache struct {
+	mu         sync.Mutex
+	thumbnails map[string][]byte
+}
+
+func newThumbnailCache() *thumbnailCache {
+	return &thumbnailCache{thumbnails: make(map[string][]byte)}
+}
+
+func (c *thumbnailCache) get(dir string, name string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.thumbnails[name]; ok {
+		return data, nil
+	}
+
+	img, err := imgmatch.LoadImage(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	thumbnail := resize.Thumbnail(thumbnailSize, thumbnailSize, img, resize.Bilinear)
+	if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("encoding thumbnail: %w", err)
+	}
+	c.thumbnails[name] = buf.Bytes()
+	return buf.Bytes(), nil
+}
+
+func (s *Server) serveThumbnail(w http.ResponseWriter, id string) {
+	name, err := library.Resolve(s.samplesDir, id)
+	if err == nil && strings.HasPrefix(name, ".") {
+		err = fmt.Errorf("sample %s not found", id)
+	}
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	data, err := s.thumbnails.get(s.samplesDir, name)
+	if err != nil {
+		logrus.Errorf("Error making thumbnail of %s: %v", name, err)
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("internal error"))
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,106 @@
+// Package evaluation calculates detector quality metrics over a labeled corpus.
+package evaluation
+
+// Confusion is a confusion matrix of a binary spam classifier.
+type Confusion struct {
+	TruePositive  int `json:"true_positive"`
+	FalsePositive int `json:"false_positive"`
+	TrueNegative  int `json:"true_negative"`
+	FalseNegative int `json:"false_negative"`
+}
+
+func (c *Confusion) Add(predictedSpam, spam bool) {
+	switch {
+	case predictedSpam && spam:
+		c.TruePositive++
+	case predictedSpam && !spam:
+		c.FalsePositive++
+	case !predictedSpam && spam:
+		c.FalseNegative++
+	default:
+		c.TrueNegative++
+	}
+}
+
+func (c Confusion) Precision() float64 {
+	return ratio(c.TruePositive, c.TruePositive+c.FalsePositive)
+}
+
+func (c Confusion) Recall() float64 {
+	return ratio(c.TruePositive, c.TruePositive+c.FalseNegative)
+}
+
+func (c Confusion) FalsePositiveRate() float64 {
+	return ratio(c.FalsePositive, c.FalsePositive+c.TrueNegative)
+}
+
+func (c Confusion) F1() float64 {
+	p, r := c.Precision(), c.Recall()
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// Result is the evaluation result of a detector.
+type Result struct {
+	Detector  string    `json:"detector"`
+	Samples   int       `json:"samples"`
+	Confusion Confusion `json:"confusion"`
+	Precision float64   `json:"precision"`
+	Recall    float64   `json:"recall"`
+	F1        float64   `json:"f1"`
+}
+
+func NewResult(detector string, c Confusion) Result {
+	return Result{
+		Detector:  detector,
+		Samples:   c.TruePositive + c.FalsePositive + c.TrueNegative + c.FalseNegative,
+		Confusion: c,
+		Precision: c.Precision(),
+		Recall:    c.Recall(),
+		F1:        c.F1(),
+	}
+}
+
+// ROCPoint is the detector quality with the given threshold.
+type ROCPoint struct {
+	Threshold         int     `json:"threshold"`
+	TruePositiveRate  float64 `json:"true_positive_rate"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+	Precision         float64 `json:"precision"`
+	F1                float64 `json:"f1"`
+}
+
+// Distance is the distance of a labeled sample to the closest known spam.
+type Distance struct {
+	Value int
+	Spam  bool
+}
+
+// SweepThresholds builds the ROC curve of a distance based detector,
+// which considers samples within the threshold to be spam.
+func SweepThresholds(distances []Distance, maxThreshold int) []ROCPoint {
+	points := make([]ROCPoint, 0, maxThreshold+1)
+	for t := 0; t <= maxThreshold; t++ {
+		var c Confusion
+		for _, d := range distances {
+			c.Add(d.Value <= t, d.Spam)
+		}
+		points = append(points, ROCPoint{
+			Threshold:         t,
+			TruePositiveRate:  c.Recall(),
+			FalsePositiveRate: c.FalsePositiveRate(),
+			Precision:         c.Precision(),
+			F1:                c.F1(),
+		})
+	}
+	return points
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
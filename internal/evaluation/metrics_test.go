@@ -0,0 +1,91 @@
+package evaluation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConfusion(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		samples   [][2]bool // predicted spam, spam
+		want      Confusion
+		precision float64
+		recall    float64
+		f1        float64
+	}{
+		{name: "empty", want: Confusion{}},
+		{
+			name:      "perfect",
+			samples:   [][2]bool{{true, true}, {false, false}},
+			want:      Confusion{TruePositive: 1, TrueNegative: 1},
+			precision: 1, recall: 1, f1: 1,
+		},
+		{
+			name:      "mixed",
+			samples:   [][2]bool{{true, true}, {true, true}, {true, false}, {false, true}, {false, false}},
+			want:      Confusion{TruePositive: 2, FalsePositive: 1, FalseNegative: 1, TrueNegative: 1},
+			precision: 2.0 / 3, recall: 2.0 / 3, f1: 2.0 / 3,
+		},
+		{
+			name:    "nothing flagged",
+			samples: [][2]bool{{false, true}, {false, false}},
+			want:    Confusion{FalseNegative: 1, TrueNegative: 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Confusion
+			for _, s := range tc.samples {
+				c.Add(s[0], s[1])
+			}
+			if c != tc.want {
+				t.Fatalf("got %+v, expected %+v", c, tc.want)
+			}
+			if !almostEqual(c.Precision(), tc.precision) {
+				t.Errorf("got precision %f, expected %f", c.Precision(), tc.precision)
+			}
+			if !almostEqual(c.Recall(), tc.recall) {
+				t.Errorf("got recall %f, expected %f", c.Recall(), tc.recall)
+			}
+			if !almostEqual(c.F1(), tc.f1) {
+				t.Errorf("got F1 %f, expected %f", c.F1(), tc.f1)
+			}
+		})
+	}
+}
+
+func TestSweepThresholds(t *testing.T) {
+	distances := []Distance{
+		{Value: 0, Spam: true},
+		{Value: 2, Spam: true},
+		{Value: 3, Spam: false},
+		{Value: 5, Spam: false},
+	}
+	points := SweepThresholds(distances, 5)
+	if len(points) != 6 {
+		t.Fatalf("got %d points, expected 6", len(points))
+	}
+	for _, tc := range []struct {
+		threshold int
+		tpr       float64
+		fpr       float64
+		precision float64
+	}{
+		{threshold: 0, tpr: 0.5, fpr: 0, precision: 1},
+		{threshold: 2, tpr: 1, fpr: 0, precision: 1},
+		{threshold: 3, tpr: 1, fpr: 0.5, precision: 2.0 / 3},
+		{threshold: 5, tpr: 1, fpr: 1, precision: 0.5},
+	} {
+		p := points[tc.threshold]
+		if p.Threshold != tc.threshold {
+			t.Fatalf("got threshold %d at index %d", p.Threshold, tc.threshold)
+		}
+		if !almostEqual(p.TruePositiveRate, tc.tpr) || !almostEqual(p.FalsePositiveRate, tc.fpr) || !almostEqual(p.Precision, tc.precision) {
+			t.Errorf("threshold %d: got %+v, expected TPR %f, FPR %f, precision %f", tc.threshold, p, tc.tpr, tc.fpr, tc.precision)
+		}
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -0,0 +1,119 @@
+package imgmatch
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/corona10/goimagehash"
+)
+
+// allowlistFile is kept in the samples directory, hidden from the sample loader.
+const allowlistFile = ".allowlist"
+
+// loadAllowlist reads lines of "<hash>\t<name>".
+func (m *Matcher) loadAllowlist() error {
+	f, err := os.Open(filepath.Join(m.dir, allowlistFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening allowlist: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("malformed allowlist line %d", line)
+		}
+		hash, err := goimagehash.ImageHashFromString(parts[0])
+		if err != nil {
+			return fmt.Errorf("parsing allowlist hash on line %d: %w", line, err)
+		}
+		m.allowlist[parts[1]] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading allowlist: %w", err)
+	}
+	return nil
+}
+
+// saveAllowlist must be called with the lock held.
+func (m *Matcher) saveAllowlist() error {
+	names := make([]string, 0, len(m.allowlist))
+	for name := range m.allowlist {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s\t%s\n", m.allowlist[name].ToString(), name)
+	}
+	path := filepath.Join(m.dir, allowlistFile)
+	if err := os.WriteFile(path+".tmp", []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("writing allowlist: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("replacing allowlist: %w", err)
+	}
+	return nil
+}
+
+// Allow adds the image to the allowlist. Allowlisted images are never learned as samples,
+// and images closer to them than to any sample don't match.
+func (m *Matcher) Allow(name string, img image.Image) error {
+	hash, err := Hash(img)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.allowlist[name] = hash
+	return m.saveAllowlist()
+}
+
+// Disallow removes the image from the allowlist.
+func (m *Matcher) Disallow(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.allowlist[name]; !ok {
+		return false, nil
+	}
+	delete(m.allowlist, name)
+	return true, m.saveAllowlist()
+}
+
+// Allowlist returns the names of allowlisted images.
+func (m *Matcher) Allowlist() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.allowlist))
+	for name := range m.allowlist {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// allowlisted returns the allowlist entry close to the hash, must be called with the lock held.
+func (m *Matcher) allowlisted(hash *goimagehash.ImageHash) (string, error) {
+	name, dist, err := closest(hash, m.allowlist)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || dist > m.interestingSampleThreshold {
+		return "", nil
+	}
+	return name, nil
+}
@@ -0,0 +1,89 @@
+package imgmatch
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF format.
+	_ "image/jpeg" // Register JPEG format.
+	_ "image/png"  // Register PNG format.
+	"io"
+	"os"
+
+	"github.com/corona10/goimagehash"
+)
+
+// Decode decodes an image of any supported format.
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	return img, nil
+}
+
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer file.Close()
+
+	img, err := Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// Hash calculates the perception hash used for matching.
+func Hash(img image.Image) (*goimagehash.ImageHash, error) {
+	hash, err := goimagehash.PerceptionHash(img)
+	if err != nil {
+		return nil, fmt.Errorf("calculating hash: %w", err)
+	}
+	return hash, nil
+}
+
+// Cluster groups the hashes, so that each hash is within the threshold
+// of another one in its cluster. Returns indices of the hashes.
+func Cluster(hashes []*goimagehash.ImageHash, threshold int) ([][]int, error) {
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			dist, err := hashes[i].Distance(hashes[j])
+			if err != nil {
+				return nil, fmt.Errorf("calculating distance: %w", err)
+			}
+			if dist <= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range hashes {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+	clusters := make([][]int, 0, len(roots))
+	for _, root := range roots {
+		clusters = append(clusters, groups[root])
+	}
+	return clusters, nil
+}
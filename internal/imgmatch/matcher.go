@@ -3,9 +3,9 @@ package imgmatch
 import (
 	"fmt"
 	"image"
-	"image/jpeg"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -15,9 +15,14 @@ import (
 
 func NewMatcher(samplesDir string, interestingThreshold, suspiciousThreshold int) (*Matcher, error) {
 	m := &Matcher{
+		dir:                        samplesDir,
 		interestingSampleThreshold: interestingThreshold,
 		suspiciousSampleThreshold:  suspiciousThreshold,
 		samples:                    make(map[string]*goimagehash.ImageHash),
+		allowlist:                  make(map[string]*goimagehash.ImageHash),
+	}
+	if err := m.loadAllowlist(); err != nil {
+		return nil, err
 	}
 	entries, err := os.ReadDir(samplesDir)
 	if err != nil {
@@ -28,14 +33,9 @@ func NewMatcher(samplesDir string, interestingThreshold, suspiciousThreshold int
 			continue
 		}
 		fullPath := filepath.Join(samplesDir, entry.Name())
-		file, err := os.Open(fullPath)
-		if err != nil {
-			return nil, fmt.Errorf("opening %s: %w", fullPath, err)
-		}
-
-		img, err := jpeg.Decode(file)
+		img, err := LoadImage(fullPath)
 		if err != nil {
-			return nil, fmt.Errorf("decoding %s as jpeg: %w", fullPath, err)
+			return nil, fmt.Errorf("loading sample: %w", err)
 		}
 		if _, err := m.AddSample(entry.Name(), img); err != nil {
 			return nil, fmt.Errorf("adding sample %s: %w", fullPath, err)
@@ -46,23 +46,33 @@ func NewMatcher(samplesDir string, interestingThreshold, suspiciousThreshold int
 }
 
 type Matcher struct {
+	dir                        string
 	interestingSampleThreshold int
 	suspiciousSampleThreshold  int
 
-	mu      sync.RWMutex
-	samples map[string]*goimagehash.ImageHash
+	mu        sync.RWMutex
+	samples   map[string]*goimagehash.ImageHash
+	allowlist map[string]*goimagehash.ImageHash
 }
 
 func (m *Matcher) AddSample(name string, img image.Image) (added bool, err error) {
-	hash, err := goimagehash.PerceptionHash(img)
+	hash, err := Hash(img)
 	if err != nil {
-		return false, fmt.Errorf("calculating hash: %w", err)
+		return false, err
 	}
 	logger := logrus.WithField("image_sample", name)
 	logger.Debugf("Got new sample with hash %v", hash.ToString())
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	allowed, err := m.allowlisted(hash)
+	if err != nil {
+		return false, err
+	}
+	if allowed != "" {
+		logger.Debugf("New sample is allowlisted as %s", allowed)
+		return false, nil
+	}
 	for otherName, otherHash := range m.samples {
 		dist, err := hash.Distance(otherHash)
 		if err != nil {
@@ -78,24 +88,94 @@ func (m *Matcher) AddSample(name string, img image.Image) (added bool, err error
 }
 
 func (m *Matcher) CheckSample(img image.Image) (match bool, err error) {
-	hash, err := goimagehash.PerceptionHash(img)
+	name, err := m.MatchSample(img)
+	return name != "", err
+}
+
+// MatchSample returns the name of the sample the image matches, or an empty string.
+// Images closer to an allowlisted image than to any sample never match.
+func (m *Matcher) MatchSample(img image.Image) (string, error) {
+	hash, err := Hash(img)
 	if err != nil {
-		return false, fmt.Errorf("calculating hash: %w", err)
+		return "", err
 	}
+	return m.MatchHash(hash)
+}
+
+// MatchHash is MatchSample for an already hashed image.
+func (m *Matcher) MatchHash(hash *goimagehash.ImageHash) (string, error) {
 	logger := logrus.WithField("sample_hash", hash.ToString())
 	logger.Debugf("Checking sample")
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	for otherName, otherHash := range m.samples {
-		dist, err := hash.Distance(otherHash)
+	name, dist, err := closest(hash, m.samples)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || dist > m.suspiciousSampleThreshold {
+		return "", nil
+	}
+	allowed, allowedDist, err := closest(hash, m.allowlist)
+	if err != nil {
+		return "", err
+	}
+	if allowed != "" && allowedDist < dist {
+		logger.Debugf("Sample matches %s with dist %v, but allowlisted %s with dist %v", name, dist, allowed, allowedDist)
+		return "", nil
+	}
+	logger.Debugf("Sample matches %s with dist %v", name, dist)
+	return name, nil
+}
+
+func (m *Matcher) RemoveSample(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.samples[name]; !ok {
+		return false
+	}
+	delete(m.samples, name)
+	return true
+}
+
+// Samples returns the names of all samples.
+func (m *Matcher) Samples() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.samples))
+	for name := range m.samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClosestSample returns the sample nearest to the image and the distance to it.
+// The name is empty if there are no samples.
+func (m *Matcher) ClosestSample(img image.Image) (name string, dist int, err error) {
+	hash, err := Hash(img)
+	if err != nil {
+		return "", 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return closest(hash, m.samples)
+}
+
+func closest(hash *goimagehash.ImageHash, hashes map[string]*goimagehash.ImageHash) (name string, dist int, err error) {
+	for otherName, otherHash := range hashes {
+		d, err := hash.Distance(otherHash)
 		if err != nil {
-			return false, fmt.Errorf("calculating distance to hash %s: %w", otherName, err)
+			return "", 0, fmt.Errorf("calculating distance to hash %s: %w", otherName, err)
 		}
-		if dist <= m.suspiciousSampleThreshold {
-			logger.Debugf("Sample matches %s with dist %v", otherName, dist)
-			return true, nil
+		if name == "" || d < dist {
+			name, dist = otherName, d
 		}
 	}
-	return false, nil
+	return name, dist, nil
+}
+
+func (m *Matcher) SuspiciousThreshold() int {
+	return m.suspiciousSampleThreshold
 }
@@ -0,0 +1,117 @@
+// Package library manages image samples stored on disk together with their match statistics.
+package library
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pomo-mondreganto/goas/internal/storage"
+)
+
+// Sample describes a sample file and its hit statistics.
+type Sample struct {
+	Name    string    `json:"name"`
+	Hits    int64     `json:"hits"`
+	LastHit time.Time `json:"last_hit,omitempty"`
+	Added   time.Time `json:"added"`
+}
+
+// LastActive is the last time the sample was useful, counting the addition as such.
+func (s Sample) LastActive() time.Time {
+	if s.LastHit.After(s.Added) {
+		return s.LastHit
+	}
+	return s.Added
+}
+
+// List returns the samples in the directory, using file modification time as the time added.
+func List(dir string, stats map[string]storage.SampleStats) ([]Sample, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing samples directory: %w", err)
+	}
+	result := make([]Sample, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("getting %s info: %w", entry.Name(), err)
+		}
+		st := stats[entry.Name()]
+		result = append(result, Sample{
+			Name:    entry.Name(),
+			Hits:    st.Hits,
+			LastHit: st.LastHit,
+			Added:   info.ModTime(),
+		})
+	}
+	return result, nil
+}
+
+// Top returns up to n most matched samples.
+func Top(samples []Sample, n int) []Sample {
+	sorted := append([]Sample(nil), samples...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Hits > sorted[j].Hits
+	})
+	result := make([]Sample, 0, n)
+	for _, s := range sorted {
+		if len(result) == n || s.Hits == 0 {
+			break
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// Unused returns the samples that never matched anything.
+func Unused(samples []Sample) []Sample {
+	result := make([]Sample, 0)
+	for _, s := range samples {
+		if s.Hits == 0 {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Stale returns the samples that were neither added nor matched since the time.
+func Stale(samples []Sample, since time.Time) []Sample {
+	result := make([]Sample, 0)
+	for _, s := range samples {
+		if s.LastActive().Before(since) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Resolve finds the sample file name by either the name itself or the sample id.
+func Resolve(dir string, id string) (string, error) {
+	for _, name := range []string{id, fmt.Sprintf("sample_%s.jpeg", id)} {
+		if name != filepath.Base(name) {
+			return "", fmt.Errorf("invalid sample id %q", id)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("sample %s not found", id)
+}
+
+// Remove deletes the sample file and its statistics.
+func Remove(dir string, name string, s *storage.Storage) error {
+	if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing sample file: %w", err)
+	}
+	if err := s.DeleteSampleStats(name); err != nil {
+		return fmt.Errorf("removing sample stats: %w", err)
+	}
+	return nil
+}
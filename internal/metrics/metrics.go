@@ -0,0 +1,107 @@
+// Package metrics exposes the bot's Prometheus metrics and health checks.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "goas"
+
+var (
+	Updates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Updates processed, by type.",
+	}, []string{"type"})
+
+	DetectorHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "detector_hits_total",
+		Help:      "Detector hits, by detector and the verdict on the message.",
+	}, []string{"detector", "verdict"})
+
+	Actions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "actions_total",
+		Help:      "Actions requested, by action.",
+	}, []string{"action"})
+
+	ActionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "action_failures_total",
+		Help:      "Actions that failed permanently, by action.",
+	}, []string{"action"})
+
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "outbound_queue_depth",
+		Help:      "Outbound requests not yet delivered or given up on.",
+	})
+
+	APILatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Telegram Bot API request latency, by method.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"method"})
+
+	ImageDownload = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_download_duration_seconds",
+		Help:      "Time to download an image, including getting its link.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+
+	ImageHash = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_hash_duration_seconds",
+		Help:      "Time to calculate the perception hash of a checked image.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+
+	samples = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "samples",
+		Help:      "Spam image samples loaded.",
+	}, func() float64 {
+		samplesMu.RLock()
+		defer samplesMu.RUnlock()
+		if countSamples == nil {
+			return 0
+		}
+		return float64(countSamples())
+	})
+
+	samplesMu    sync.RWMutex
+	countSamples func() int
+
+	// Registry has only the bot's metrics, so that the tools importing
+	// the packages don't register them globally.
+	Registry = prometheus.NewRegistry()
+)
+
+func init() {
+	Registry.MustRegister(
+		Updates,
+		DetectorHits,
+		Actions,
+		ActionFailures,
+		QueueDepth,
+		APILatency,
+		ImageDownload,
+		ImageHash,
+		samples,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// CountSamples sets the function reporting the sample count.
+func CountSamples(fn func() int) {
+	samplesMu.Lock()
+	defer samplesMu.Unlock()
+	countSamples = fn
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Check returns an error if the component isn't healthy.
+type Check func() error
+
+// Server serves /metrics, /healthz and /readyz.
+type Server struct {
+	srv *http.Server
+}
+
+// NewServer creates the server, /healthz fails if any of the liveness checks fails,
+// /readyz fails if any of the liveness or readiness checks fails.
+func NewServer(addr string, live []Check, ready []Check) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", checkHandler(live))
+	mux.Handle("/readyz", checkHandler(append(append([]Check{}, live...), ready...)))
+	return &Server{srv: &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}}
+}
+
+// Run serves until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.srv.ListenAndServe()
+	}()
+	logrus.Infof("Serving metrics on %s", s.srv.Addr)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("serving metrics: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down metrics server: %w", err)
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+	return nil
+}
+
+func checkHandler(checks []Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, check := range checks {
+			if err := check(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+}
@@ -0,0 +1,88 @@
+// Package recorder archives incoming updates and downloaded files as JSON lines,
+// so that the traffic can be replayed later.
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Entry is a single archive line, either an update or a file.
+type Entry struct {
+	Time   time.Time        `json:"time"`
+	Update *tgbotapi.Update `json:"update,omitempty"`
+	FileID string           `json:"file_id,omitempty"`
+	File   []byte           `json:"file,omitempty"`
+}
+
+func New(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	return &Recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (r *Recorder) RecordUpdate(upd tgbotapi.Update) error {
+	return r.write(Entry{Time: time.Now(), Update: &upd})
+}
+
+func (r *Recorder) RecordFile(fileID string, data []byte) error {
+	return r.write(Entry{Time: time.Now(), FileID: fileID, File: data})
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.f.Close(); err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) write(e Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(e); err != nil {
+		return fmt.Errorf("writing entry: %w", err)
+	}
+	return nil
+}
+
+// Read calls fn for every archive entry in order.
+func Read(path string, fn func(Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("parsing line %d: %w", line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+	return nil
+}
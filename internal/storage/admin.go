@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// compactTxSize is the transaction size used to copy data while compacting.
+const compactTxSize = 64 << 20
+
+// BucketStats describes a top level bucket.
+type BucketStats struct {
+	Name    string `json:"name"`
+	Keys    int    `json:"keys"`
+	Buckets int    `json:"buckets"`
+}
+
+func (s Storage) Stats() ([]BucketStats, error) {
+	var result []BucketStats
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			st := b.Stats()
+			result = append(result, BucketStats{
+				Name:    string(name),
+				Keys:    st.KeyN,
+				Buckets: st.BucketN - 1,
+			})
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return result, nil
+}
+
+// Export writes the whole database as a JSON object, with nested buckets as nested objects.
+func (s Storage) Export(w io.Writer) error {
+	var data map[string]interface{}
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		data = make(map[string]interface{})
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			data[string(name)] = exportBucket(b)
+			return nil
+		})
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return fmt.Errorf("encoding data: %w", err)
+	}
+	return nil
+}
+
+// Compact copies the database to dst, dropping the free pages.
+func (s Storage) Compact(dst string) error {
+	db, err := bolt.Open(dst, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return fmt.Errorf("opening destination: %w", err)
+	}
+	if err := bolt.Compact(db, s.db, compactTxSize); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("compacting: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("closing destination: %w", err)
+	}
+	return nil
+}
+
+func exportBucket(b *bolt.Bucket) map[string]interface{} {
+	result := make(map[string]interface{})
+	_ = b.ForEach(func(k, v []byte) error {
+		switch {
+		case v == nil:
+			result[string(k)] = exportBucket(b.Bucket(k))
+		case utf8.Valid(v):
+			result[string(k)] = string(v)
+		default:
+			result[string(k)] = v
+		}
+		return nil
+	})
+	return result
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// AuditEntry is an action taken, or in shadow mode that would have been taken, by the bot.
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	ChatID  int64     `json:"chat_id"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target,omitempty"`
+	Details string    `json:"details,omitempty"`
+	Shadow  bool      `json:"shadow,omitempty"`
+}
+
+func (s Storage) AddAuditEntry(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("serializing audit entry: %w", err)
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(auditBucket))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("getting next sequence: %w", err)
+		}
+		if err := b.Put(formatSequence(seq), data); err != nil {
+			return fmt.Errorf("saving audit entry %v: %w", seq, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEntries returns up to limit latest entries, oldest first.
+// Zero chat ID means all chats, zero limit means no limit.
+func (s Storage) GetAuditEntries(chatID int64, limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(auditBucket)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var entry AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("parsing audit entry %v: %w", string(k), err)
+			}
+			if chatID != 0 && entry.ChatID != chatID {
+				continue
+			}
+			entries = append(entries, entry)
+			if limit > 0 && len(entries) == limit {
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
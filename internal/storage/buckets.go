@@ -8,13 +8,27 @@ import (
 )
 
 const (
-	userDataBucket = "users"
-	chatDataBucket = "chats"
+	userDataBucket     = "users"
+	chatDataBucket     = "chats"
+	deadLetterBucket   = "dead_letters"
+	sampleDataBucket   = "samples"
+	auditBucket        = "audit"
+	pendingVotesBucket = "pending_votes"
+	restrictionsBucket = "restrictions"
+	trustBucket        = "trust"
+	fingerprintsBucket = "fingerprints"
 )
 
 var bucketNames = []string{
 	userDataBucket,
 	chatDataBucket,
+	deadLetterBucket,
+	sampleDataBucket,
+	auditBucket,
+	pendingVotesBucket,
+	restrictionsBucket,
+	trustBucket,
+	fingerprintsBucket,
 }
 
 func (s Storage) initBuckets() error {
@@ -31,3 +45,18 @@ func (s Storage) initBuckets() error {
 	}
 	return nil
 }
+
+// checkBuckets makes sure the database was initialized, the readers don't expect missing buckets.
+func (s Storage) checkBuckets() error {
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		for _, name := range bucketNames {
+			if tx.Bucket([]byte(name)) == nil {
+				return fmt.Errorf("bucket %v is missing, the database is not initialized", name)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ChatSummary describes a chat the bot has seen.
+type ChatSummary struct {
+	ID       int64        `json:"id"`
+	Settings ChatSettings `json:"settings"`
+	// Members is the number of users that sent messages to the chat.
+	Members int `json:"members"`
+	// Messages is the number of messages counted in the chat.
+	Messages int64 `json:"messages"`
+}
+
+// GetChats returns the chats with any data, ordered by ID.
+func (s Storage) GetChats() ([]ChatSummary, error) {
+	chats := make(map[int64]*ChatSummary)
+	chat := func(id int64) *ChatSummary {
+		if c, ok := chats[id]; ok {
+			return c
+		}
+		c := &ChatSummary{ID: id}
+		chats[id] = c
+		return c
+	}
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(chatDataBucket)).ForEach(func(k, v []byte) error {
+			id, ok := parseChatKey(string(k))
+			if !ok {
+				return nil
+			}
+			c := chat(id)
+			if string(k) == chatSettingsKey(id) {
+				if err := json.Unmarshal(v, &c.Settings); err != nil {
+					return fmt.Errorf("parsing chat %d settings: %w", id, err)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// The message counts are kept by user.
+		return tx.Bucket([]byte(userDataBucket)).ForEach(func(uk, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			return tx.Bucket([]byte(userDataBucket)).Bucket(uk).ForEach(func(k, v []byte) error {
+				id, ok := parseMessageCountKey(string(k))
+				if !ok || v == nil {
+					return nil
+				}
+				count, err := strconv.ParseInt(string(v), 10, 64)
+				if err != nil {
+					return fmt.Errorf("parsing user %s message count %s: %w", string(uk), string(k), err)
+				}
+				c := chat(id)
+				c.Members++
+				c.Messages += count
+				return nil
+			})
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+
+	result := make([]ChatSummary, 0, len(chats))
+	for _, c := range chats {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+// parseChatKey returns the chat of the chat bucket key, the keys look like chat_<kind>:<chat id>[:...].
+func parseChatKey(key string) (int64, bool) {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "chat_") {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	return id, err == nil
+}
+
+func parseMessageCountKey(key string) (int64, bool) {
+	var id int64
+	if _, err := fmt.Sscanf(key, "chat:%d:msg_count", &id); err != nil || chatMessageCountKey(id) != key {
+		return 0, false
+	}
+	return id, true
+}
+
+// hasChatPrefix tells if the chat bucket key belongs to the chat, zero matches every chat.
+func hasChatPrefix(key []byte, prefix string, chatID int64) bool {
+	if chatID == 0 {
+		return bytes.HasPrefix(key, []byte(prefix+":"))
+	}
+	return bytes.HasPrefix(key, []byte(fmt.Sprintf("%s:%d:", prefix, chatID)))
+}
@@ -6,27 +6,15 @@ import (
 	"time"
 )
 
-const (
-	trustKey     = "trusted"
-	firstSeenKey = "first_seen"
-
-	trustValue = "yes"
-)
+const firstSeenKey = "first_seen"
 
 func (s Storage) IsUserAdmin(userID int64) bool {
 	return userID == 143994885 || userID == 167389904
 }
 
-func (s Storage) TrustUser(userID int64) error {
-	return s.setUserContextKey(userID, trustKey, trustValue)
-}
-
-func (s Storage) IsUserTrusted(userID int64) (bool, error) {
-	value, err := s.getUserContextKey(userID, trustKey)
-	if err != nil {
-		return false, err
-	}
-	return value == trustValue, nil
+// GetUserData returns all plain user context keys.
+func (s Storage) GetUserData(userID int64) (map[string]string, error) {
+	return s.getUserContext(userID)
 }
 
 func (s Storage) GetOrSetUserFirstSeen(userID int64, firstSeen time.Time) (time.Time, error) {
@@ -55,10 +43,34 @@ func (s Storage) GetUserChatMessageCount(userID int64, chatID int64) (int64, err
 	return s.IncUserChatMessageCount(userID, chatID, 0)
 }
 
-func (s Storage) VoteSpam(userID int64, chatID int64, messageID int, spam bool) error {
-	return s.addVote(spam, userID, chatID, messageID)
+func (s Storage) VoteSpam(userID int64, chatID int64, messageID int, spam bool, weight int) error {
+	return s.addVote(spam, weight, userID, chatID, messageID)
 }
 
+// GetVotes returns the weighted votes for and against.
 func (s Storage) GetVotes(chatID int64, messageID int) (int, int, error) {
 	return s.getVotes(chatID, messageID)
 }
+
+func (s Storage) AddAlbumMessages(chatID int64, groupID string, messageIDs []int, at time.Time) error {
+	return s.addAlbumMessages(chatID, groupID, messageIDs, at)
+}
+
+// DeleteAlbumsBefore deletes the albums received before the time, and returns how many were deleted.
+func (s Storage) DeleteAlbumsBefore(before time.Time) (int, error) {
+	return s.deleteChatBucketsBefore([]byte("chat_album:"), nil, before)
+}
+
+func (s Storage) GetAlbumMessages(chatID int64, groupID string) ([]int, error) {
+	return s.getAlbumMessages(chatID, groupID)
+}
+
+// AddUserChatMessage remembers the user's message, keeping at most limit
+// messages not older than ttl.
+func (s Storage) AddUserChatMessage(userID int64, chatID int64, messageID int, at time.Time, limit int, ttl time.Duration) error {
+	return s.addRecentMessage(userID, chatID, messageID, at, limit, ttl)
+}
+
+func (s Storage) GetUserChatMessages(userID int64, chatID int64, since time.Time) ([]int, error) {
+	return s.getRecentMessages(userID, chatID, since)
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeadLetter is an outbound request that couldn't be delivered.
+type DeadLetter struct {
+	Time     time.Time       `json:"time"`
+	Request  string          `json:"request"`
+	Payload  json.RawMessage `json:"payload"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+}
+
+func (s Storage) AddDeadLetter(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("serializing dead letter: %w", err)
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(deadLetterBucket))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return fmt.Errorf("getting next sequence: %w", err)
+		}
+		if err := b.Put(formatSequence(seq), data); err != nil {
+			return fmt.Errorf("saving dead letter %v: %w", seq, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) GetDeadLetters() ([]DeadLetter, error) {
+	var letters []DeadLetter
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(deadLetterBucket))
+		if err := b.ForEach(func(k, v []byte) error {
+			var letter DeadLetter
+			if err := json.Unmarshal(v, &letter); err != nil {
+				return fmt.Errorf("parsing dead letter %v: %w", string(k), err)
+			}
+			letters = append(letters, letter)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating dead letters: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return letters, nil
+}
+
+// DeleteDeadLettersBefore deletes the dead letters older than the time,
+// and returns how many were deleted.
+func (s Storage) DeleteDeadLettersBefore(before time.Time) (int, error) {
+	deleted := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(deadLetterBucket))
+		var stale [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			var letter DeadLetter
+			if err := json.Unmarshal(v, &letter); err != nil || letter.Time.Before(before) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating dead letters: %w", err)
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("deleting dead letter %v: %w", string(k), err)
+			}
+		}
+		deleted = len(stale)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Detection records why a message was considered spam.
+type Detection struct {
+	Time     time.Time `json:"time"`
+	Sender   string    `json:"sender"`
+	SenderID int64     `json:"sender_id"`
+	Verdict  string    `json:"verdict"`
+	Reason   string    `json:"reason"`
+	Patterns []string  `json:"patterns,omitempty"`
+	Samples  []string  `json:"samples,omitempty"`
+	Photos   []string  `json:"photos,omitempty"`
+}
+
+func (s Storage) SaveDetection(chatID int64, messageID int, d Detection) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("serializing detection: %w", err)
+	}
+	return s.setChatKey(chatDetectionKey(chatID, messageID), data)
+}
+
+// GetDetection returns nil if the message wasn't detected as spam.
+func (s Storage) GetDetection(chatID int64, messageID int) (*Detection, error) {
+	data, err := s.getChatKey(chatDetectionKey(chatID, messageID))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var d Detection
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("parsing detection: %w", err)
+	}
+	return &d, nil
+}
+
+// ChatDetection is the detection of a message in a chat.
+type ChatDetection struct {
+	ChatID    int64     `json:"chat_id"`
+	MessageID int       `json:"message_id"`
+	Detection Detection `json:"detection"`
+}
+
+// GetRecentDetections returns up to limit latest detections in the chat,
+// or in all chats if chatID is zero.
+func (s Storage) GetRecentDetections(chatID int64, limit int) ([]ChatDetection, error) {
+	var result []ChatDetection
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(chatDataBucket)).ForEach(func(k, v []byte) error {
+			if v == nil || !bytes.HasSuffix(k, []byte(":detection")) || !hasChatPrefix(k, "chat_msg", chatID) {
+				return nil
+			}
+			var cd ChatDetection
+			if _, err := fmt.Sscanf(string(k), "chat_msg:%d:%d:detection", &cd.ChatID, &cd.MessageID); err != nil {
+				return fmt.Errorf("parsing detection key %v: %w", string(k), err)
+			}
+			if err := json.Unmarshal(v, &cd.Detection); err != nil {
+				return fmt.Errorf("parsing detection %v: %w", string(k), err)
+			}
+			result = append(result, cd)
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Detection.Time.After(result[j].Detection.Time) })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// SetAlertMessage remembers that the bot's alert is about the message.
+func (s Storage) SetAlertMessage(chatID int64, alertID int, messageID int) error {
+	return s.setChatKey(chatAlertKey(chatID, alertID), intToBytes(int64(messageID)))
+}
+
+// GetAlertMessage returns the message the alert is about, or 0 if it's not an alert.
+func (s Storage) GetAlertMessage(chatID int64, alertID int) (int, error) {
+	data, err := s.getChatKey(chatAlertKey(chatID, alertID))
+	if err != nil || data == nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("parsing message id %v: %w", string(data), err)
+	}
+	return id, nil
+}
+
+// DeleteDetectionsBefore deletes the detections older than the time along with the alerts
+// about the messages without detections, and returns how many detections were deleted.
+func (s Storage) DeleteDetectionsBefore(before time.Time) (int, error) {
+	deleted := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		var stale, alerts [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			switch {
+			case v == nil:
+			case bytes.HasSuffix(k, []byte(":detection")):
+				var d Detection
+				if err := json.Unmarshal(v, &d); err != nil || d.Time.Before(before) {
+					stale = append(stale, append([]byte(nil), k...))
+				}
+			case bytes.HasSuffix(k, []byte(":alert_for")):
+				alerts = append(alerts, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating chat data: %w", err)
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("deleting detection %v: %w", string(k), err)
+			}
+		}
+		deleted = len(stale)
+
+		// Alerts are only needed to find the detections.
+		for _, k := range alerts {
+			var chatID int64
+			var alertID int
+			if _, err := fmt.Sscanf(string(k), "chat_msg:%d:%d:alert_for", &chatID, &alertID); err != nil {
+				return fmt.Errorf("parsing alert key %v: %w", string(k), err)
+			}
+			messageID, err := strconv.Atoi(string(b.Get(k)))
+			if err == nil && b.Get([]byte(chatDetectionKey(chatID, messageID))) != nil {
+				continue
+			}
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("deleting alert %v: %w", string(k), err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s Storage) setChatKey(key string, value []byte) error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		if err := b.Put([]byte(key), value); err != nil {
+			return fmt.Errorf("setting chat key %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) getChatKey(key string) ([]byte, error) {
+	var result []byte
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		if data := b.Get([]byte(key)); data != nil {
+			result = append([]byte(nil), data...)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return result, nil
+}
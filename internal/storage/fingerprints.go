@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Fingerprint is what a message contained, to tell what an edit changed.
+type Fingerprint struct {
+	Time time.Time `json:"time"`
+	// Hash is of the text, the caption and the media.
+	Hash     string   `json:"hash"`
+	Links    []string `json:"links,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+func (s Storage) SetFingerprint(chatID int64, messageID int, f Fingerprint) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("serializing fingerprint: %w", err)
+	}
+	key := chatMessageKey(chatID, messageID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(fingerprintsBucket)).Put([]byte(key), data); err != nil {
+			return fmt.Errorf("saving fingerprint %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// GetFingerprint returns nil if the message isn't known.
+func (s Storage) GetFingerprint(chatID int64, messageID int) (*Fingerprint, error) {
+	key := chatMessageKey(chatID, messageID)
+	var f *Fingerprint
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(fingerprintsBucket)).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		f = new(Fingerprint)
+		if err := json.Unmarshal(data, f); err != nil {
+			return fmt.Errorf("parsing fingerprint %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return f, nil
+}
+
+// DeleteFingerprintsBefore deletes the fingerprints of messages older than the time,
+// and returns how many were deleted.
+func (s Storage) DeleteFingerprintsBefore(before time.Time) (int, error) {
+	deleted := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(fingerprintsBucket))
+		var stale [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			var f Fingerprint
+			if err := json.Unmarshal(v, &f); err != nil || f.Time.Before(before) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating fingerprints: %w", err)
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("deleting fingerprint %v: %w", string(k), err)
+			}
+		}
+		deleted = len(stale)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return deleted, nil
+}
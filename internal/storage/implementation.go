@@ -1,8 +1,10 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -44,6 +46,48 @@ func (s Storage) setUserContextKey(userID int64, key string, value string) error
 	return nil
 }
 
+func (s Storage) deleteUserContextKey(userID int64, key string) error {
+	uk := formatUID(userID)
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(userDataBucket))
+		nested := b.Bucket(uk)
+		if nested == nil {
+			return nil
+		}
+		if err := nested.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("deleting user's %v key %v: %w", userID, key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transcation: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) getUserContext(userID int64) (map[string]string, error) {
+	uk := formatUID(userID)
+
+	result := make(map[string]string)
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(userDataBucket))
+		nested := b.Bucket(uk)
+		if nested == nil {
+			return nil
+		}
+		return nested.ForEach(func(k, v []byte) error {
+			// Nested buckets have nil values.
+			if v != nil {
+				result[string(k)] = string(v)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("executing transcation: %w", err)
+	}
+	return result, nil
+}
+
 func (s Storage) getOrSetUserContextKey(userID int64, key string, value string) (string, error) {
 	uk := formatUID(userID)
 
@@ -99,7 +143,7 @@ func (s Storage) addToUserContextKey(userID int64, key string, value int64) (int
 	return result, nil
 }
 
-func (s Storage) addVote(vote bool, userID int64, chatID int64, messageID int) error {
+func (s Storage) addVote(vote bool, weight int, userID int64, chatID int64, messageID int) error {
 	bk := chatMessageVotesBucketKey(chatID, messageID)
 	uid := formatUID(userID)
 	if err := s.db.Update(func(tx *bolt.Tx) error {
@@ -108,7 +152,7 @@ func (s Storage) addVote(vote bool, userID int64, chatID int64, messageID int) e
 		if err != nil {
 			return fmt.Errorf("creaing bucket %v: %w", bk, err)
 		}
-		if err := nested.Put(uid, formatVote(vote)); err != nil {
+		if err := nested.Put(uid, formatVote(vote, weight)); err != nil {
 			return fmt.Errorf("setting vote for %v: %w", uid, err)
 		}
 		return nil
@@ -127,11 +171,11 @@ func (s Storage) getVotes(chatID int64, messageID int) (f int, a int, err error)
 			return nil
 		}
 		if err := nested.ForEach(func(_, v []byte) error {
-			vote := parseVote(v)
+			vote, weight := parseVote(v)
 			if vote {
-				f += 1
+				f += weight
 			} else {
-				a += 1
+				a += weight
 			}
 			return nil
 		}); err != nil {
@@ -141,3 +185,173 @@ func (s Storage) getVotes(chatID int64, messageID int) (f int, a int, err error)
 	})
 	return
 }
+
+func (s Storage) addAlbumMessages(chatID int64, groupID string, messageIDs []int, at time.Time) error {
+	bk := chatAlbumBucketKey(chatID, groupID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		nested, err := b.CreateBucketIfNotExists([]byte(bk))
+		if err != nil {
+			return fmt.Errorf("creating bucket %v: %w", bk, err)
+		}
+		for _, id := range messageIDs {
+			if err := nested.Put(intToBytes(int64(id)), intToBytes(at.UnixNano())); err != nil {
+				return fmt.Errorf("adding message %v: %w", id, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) getAlbumMessages(chatID int64, groupID string) (ids []int, err error) {
+	bk := chatAlbumBucketKey(chatID, groupID)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		nested := b.Bucket([]byte(bk))
+		if nested == nil {
+			return nil
+		}
+		if err := nested.ForEach(func(k, _ []byte) error {
+			id, err := strconv.Atoi(string(k))
+			if err != nil {
+				return fmt.Errorf("parsing message id %v: %w", string(k), err)
+			}
+			ids = append(ids, id)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating album bucket: %w", err)
+		}
+		return nil
+	})
+	return
+}
+
+// deleteChatBucketsBefore deletes the nested chat buckets with the prefix and the suffix
+// whose values are timestamps, all older than the time. Values that aren't timestamps count as old.
+func (s Storage) deleteChatBucketsBefore(prefix, suffix []byte, before time.Time) (int, error) {
+	deleted := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		var stale [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			// Nested buckets have nil values.
+			if v != nil || !bytes.HasPrefix(k, prefix) || !bytes.HasSuffix(k, suffix) {
+				return nil
+			}
+			var latest int64
+			if err := b.Bucket(k).ForEach(func(_, v []byte) error {
+				if nano, err := strconv.ParseInt(string(v), 10, 64); err == nil && nano > latest {
+					latest = nano
+				}
+				return nil
+			}); err != nil {
+				return fmt.Errorf("iterating bucket %v: %w", string(k), err)
+			}
+			if latest < before.UnixNano() {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating chat data: %w", err)
+		}
+		for _, k := range stale {
+			if err := b.DeleteBucket(k); err != nil {
+				return fmt.Errorf("deleting bucket %v: %w", string(k), err)
+			}
+		}
+		deleted = len(stale)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return deleted, nil
+}
+
+func (s Storage) addRecentMessage(userID int64, chatID int64, messageID int, at time.Time, limit int, ttl time.Duration) error {
+	uk := formatUID(userID)
+	bk := chatRecentMessagesBucketKey(chatID)
+	expired := at.Add(-ttl).UnixNano()
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(userDataBucket))
+		nested, err := b.CreateBucketIfNotExists(uk)
+		if err != nil {
+			return fmt.Errorf("creating bucket %v: %w", uk, err)
+		}
+		recent, err := nested.CreateBucketIfNotExists([]byte(bk))
+		if err != nil {
+			return fmt.Errorf("creating bucket %v: %w", bk, err)
+		}
+		if err := recent.Put(formatMessageID(messageID), intToBytes(at.UnixNano())); err != nil {
+			return fmt.Errorf("adding message %v: %w", messageID, err)
+		}
+
+		// Keys are ordered by message id, so the oldest messages come first.
+		var keys, stale [][]byte
+		if err := recent.ForEach(func(k, v []byte) error {
+			ts, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing message %v time (%v): %w", string(k), string(v), err)
+			}
+			k = append([]byte(nil), k...)
+			if ts < expired {
+				stale = append(stale, k)
+			} else {
+				keys = append(keys, k)
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating recent messages bucket: %w", err)
+		}
+		if len(keys) > limit {
+			stale = append(stale, keys[:len(keys)-limit]...)
+		}
+		for _, k := range stale {
+			if err := recent.Delete(k); err != nil {
+				return fmt.Errorf("deleting message %v: %w", string(k), err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) getRecentMessages(userID int64, chatID int64, since time.Time) (ids []int, err error) {
+	uk := formatUID(userID)
+	bk := chatRecentMessagesBucketKey(chatID)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(userDataBucket))
+		nested := b.Bucket(uk)
+		if nested == nil {
+			return nil
+		}
+		recent := nested.Bucket([]byte(bk))
+		if recent == nil {
+			return nil
+		}
+		if err := recent.ForEach(func(k, v []byte) error {
+			ts, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing message %v time (%v): %w", string(k), string(v), err)
+			}
+			if ts < since.UnixNano() {
+				return nil
+			}
+			id, err := strconv.Atoi(string(k))
+			if err != nil {
+				return fmt.Errorf("parsing message id %v: %w", string(k), err)
+			}
+			ids = append(ids, id)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating recent messages bucket: %w", err)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	lastReportKey      = "last_report"
+	rejectedReportsKey = "rejected_reports"
+)
+
+// AddReport records the report and returns the number of distinct reporters of the message.
+func (s Storage) AddReport(chatID int64, messageID int, reporterID int64, at time.Time) (int, error) {
+	bk := chatMessageReportsBucketKey(chatID, messageID)
+	count := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		nested, err := b.CreateBucketIfNotExists([]byte(bk))
+		if err != nil {
+			return fmt.Errorf("creating bucket %v: %w", bk, err)
+		}
+		if err := nested.Put(formatUID(reporterID), intToBytes(at.UnixNano())); err != nil {
+			return fmt.Errorf("adding report of %v: %w", reporterID, err)
+		}
+		return nested.ForEach(func(_, _ []byte) error {
+			count++
+			return nil
+		})
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return count, nil
+}
+
+func (s Storage) GetReporters(chatID int64, messageID int) ([]int64, error) {
+	bk := chatMessageReportsBucketKey(chatID, messageID)
+	var reporters []int64
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		nested := tx.Bucket([]byte(chatDataBucket)).Bucket([]byte(bk))
+		if nested == nil {
+			return nil
+		}
+		if err := nested.ForEach(func(k, _ []byte) error {
+			id, err := strconv.ParseInt(string(k), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing reporter id %v: %w", string(k), err)
+			}
+			reporters = append(reporters, id)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating reports bucket: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return reporters, nil
+}
+
+func (s Storage) DeleteReports(chatID int64, messageID int) error {
+	bk := chatMessageReportsBucketKey(chatID, messageID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		if b.Bucket([]byte(bk)) == nil {
+			return nil
+		}
+		if err := b.DeleteBucket([]byte(bk)); err != nil {
+			return fmt.Errorf("deleting bucket %v: %w", bk, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteReportsBefore deletes the reports of messages last reported before the time,
+// and returns the number of messages whose reports were deleted.
+func (s Storage) DeleteReportsBefore(before time.Time) (int, error) {
+	return s.deleteChatBucketsBefore([]byte("chat_msg:"), []byte(":reports"), before)
+}
+
+func (s Storage) GetUserLastReport(userID int64) (time.Time, error) {
+	value, err := s.getUserContextKey(userID, lastReportKey)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	nano, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing last report (%v): %w", value, err)
+	}
+	return time.Unix(0, nano), nil
+}
+
+func (s Storage) SetUserLastReport(userID int64, at time.Time) error {
+	return s.setUserContextKey(userID, lastReportKey, strconv.FormatInt(at.UnixNano(), 10))
+}
+
+// IncUserRejectedReports changes the number of the user's reports that turned out wrong.
+func (s Storage) IncUserRejectedReports(userID int64, add int64) (int64, error) {
+	val, err := s.addToUserContextKey(userID, rejectedReportsKey, add)
+	if err != nil {
+		return 0, fmt.Errorf("incrementing user (%v) context key %v: %w", userID, rejectedReportsKey, err)
+	}
+	return val, nil
+}
+
+// GetUserRejectedReports returns the number of the user's reports that turned out wrong.
+func (s Storage) GetUserRejectedReports(userID int64) (int64, error) {
+	value, err := s.getUserContextKey(userID, rejectedReportsKey)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	rejected, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing rejected reports (%v): %w", value, err)
+	}
+	return rejected, nil
+}
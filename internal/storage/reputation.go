@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// formatDay returns the UTC day, the clean messages are counted by.
+func formatDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// Reputation is what the user's reputation in a chat is made of.
+type Reputation struct {
+	// CleanDays is the number of distinct days with clean messages.
+	CleanDays    int    `json:"clean_days"`
+	LastCleanDay string `json:"last_clean_day,omitempty"`
+	// TrustedReplies counts the days trusted members replied to the user.
+	TrustedReplies int    `json:"trusted_replies"`
+	LastReplyDay   string `json:"last_reply_day,omitempty"`
+	PassedVotes    int    `json:"passed_votes"`
+	Strikes        int    `json:"strikes"`
+	Reports        int    `json:"reports"`
+}
+
+// GetReputation returns false if the user has no reputation in the chat yet.
+func (s Storage) GetReputation(chatID int64, userID int64) (Reputation, bool, error) {
+	var r Reputation
+	data, err := s.getChatKey(chatUserReputationKey(chatID, userID))
+	if err != nil || data == nil {
+		return r, false, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, false, fmt.Errorf("parsing reputation: %w", err)
+	}
+	return r, true, nil
+}
+
+// SeedReputation sets the reputation unless the user already has one.
+func (s Storage) SeedReputation(chatID int64, userID int64, r Reputation) error {
+	return s.updateReputation(chatID, userID, func(old *Reputation, found bool) {
+		if !found {
+			*old = r
+		}
+	})
+}
+
+// AddCleanDay counts the day if it wasn't counted yet.
+func (s Storage) AddCleanDay(chatID int64, userID int64, at time.Time) error {
+	day := formatDay(at)
+	return s.updateReputation(chatID, userID, func(r *Reputation, _ bool) {
+		if r.LastCleanDay != day {
+			r.CleanDays++
+			r.LastCleanDay = day
+		}
+	})
+}
+
+// AddTrustedReply counts at most one reply a day.
+func (s Storage) AddTrustedReply(chatID int64, userID int64, at time.Time) error {
+	day := formatDay(at)
+	return s.updateReputation(chatID, userID, func(r *Reputation, _ bool) {
+		if r.LastReplyDay != day {
+			r.TrustedReplies++
+			r.LastReplyDay = day
+		}
+	})
+}
+
+func (s Storage) AddPassedVote(chatID int64, userID int64) error {
+	return s.updateReputation(chatID, userID, func(r *Reputation, _ bool) {
+		r.PassedVotes++
+	})
+}
+
+func (s Storage) AddReputationStrike(chatID int64, userID int64) error {
+	return s.updateReputation(chatID, userID, func(r *Reputation, _ bool) {
+		r.Strikes++
+	})
+}
+
+func (s Storage) AddReputationReport(chatID int64, userID int64) error {
+	return s.updateReputation(chatID, userID, func(r *Reputation, _ bool) {
+		r.Reports++
+	})
+}
+
+func (s Storage) updateReputation(chatID int64, userID int64, update func(r *Reputation, found bool)) error {
+	key := chatUserReputationKey(chatID, userID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		var r Reputation
+		data := b.Get([]byte(key))
+		if data != nil {
+			if err := json.Unmarshal(data, &r); err != nil {
+				return fmt.Errorf("parsing reputation %v: %w", key, err)
+			}
+		}
+		update(&r, data != nil)
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("serializing reputation: %w", err)
+		}
+		if err := b.Put([]byte(key), data); err != nil {
+			return fmt.Errorf("saving reputation %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Restriction is a sender muted while the vote on their message is pending.
+type Restriction struct {
+	ChatID   int64     `json:"chat_id"`
+	UserID   int64     `json:"user_id"`
+	PromptID int       `json:"prompt_id"`
+	Until    time.Time `json:"until"`
+	// Hidden is set if the message was deleted until the vote resolves.
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+func (s Storage) AddRestriction(r Restriction) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("serializing restriction: %w", err)
+	}
+	key := chatMessageKey(r.ChatID, r.PromptID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(restrictionsBucket)).Put([]byte(key), data); err != nil {
+			return fmt.Errorf("saving restriction %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// TakeRestriction deletes the restriction of the vote and returns it, or nil if there's none.
+func (s Storage) TakeRestriction(chatID int64, promptID int) (*Restriction, error) {
+	key := chatMessageKey(chatID, promptID)
+	var r *Restriction
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(restrictionsBucket))
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		r = new(Restriction)
+		if err := json.Unmarshal(data, r); err != nil {
+			return fmt.Errorf("parsing restriction %v: %w", key, err)
+		}
+		if err := b.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("deleting restriction %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return r, nil
+}
+
+func (s Storage) GetRestrictions() ([]Restriction, error) {
+	var restrictions []Restriction
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(restrictionsBucket)).ForEach(func(k, v []byte) error {
+			var r Restriction
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("parsing restriction %v: %w", string(k), err)
+			}
+			restrictions = append(restrictions, r)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating restrictions: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return restrictions, nil
+}
+
+// Mute is a sanction restricting the user in the chat, zero Until means it's permanent.
+type Mute struct {
+	Until time.Time `json:"until"`
+}
+
+// Active tells if the mute is still in force.
+func (m Mute) Active(now time.Time) bool {
+	return m.Until.IsZero() || m.Until.After(now)
+}
+
+// SetMute records the user's mute in the chat, replacing the previous one.
+func (s Storage) SetMute(chatID int64, userID int64, m Mute) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("serializing mute: %w", err)
+	}
+	return s.setChatKey(chatUserMuteKey(chatID, userID), data)
+}
+
+// GetMute returns the user's mute in the chat, or nil if there's none.
+func (s Storage) GetMute(chatID int64, userID int64) (*Mute, error) {
+	data, err := s.getChatKey(chatUserMuteKey(chatID, userID))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	m := new(Mute)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing mute: %w", err)
+	}
+	return m, nil
+}
+
+func (s Storage) DeleteMute(chatID int64, userID int64) error {
+	key := chatUserMuteKey(chatID, userID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(chatDataBucket)).Delete([]byte(key)); err != nil {
+			return fmt.Errorf("deleting mute %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteMutesBefore deletes the mutes that ended before the time, and returns how many were deleted.
+func (s Storage) DeleteMutesBefore(before time.Time) (int, error) {
+	deleted := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		var stale [][]byte
+		c := b.Cursor()
+		prefix := []byte("chat_mute:")
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var m Mute
+			if err := json.Unmarshal(v, &m); err != nil || (!m.Until.IsZero() && m.Until.Before(before)) {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("deleting mute %v: %w", string(k), err)
+			}
+		}
+		deleted = len(stale)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return deleted, nil
+}
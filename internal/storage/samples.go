@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SampleStats tells how often an image sample matches.
+type SampleStats struct {
+	Hits    int64     `json:"hits"`
+	LastHit time.Time `json:"last_hit"`
+}
+
+func (s Storage) AddSampleHit(name string, at time.Time) error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(sampleDataBucket))
+		var st SampleStats
+		if data := b.Get([]byte(name)); data != nil {
+			if err := json.Unmarshal(data, &st); err != nil {
+				return fmt.Errorf("parsing sample %v stats: %w", name, err)
+			}
+		}
+		st.Hits++
+		st.LastHit = at
+		data, err := json.Marshal(st)
+		if err != nil {
+			return fmt.Errorf("serializing sample %v stats: %w", name, err)
+		}
+		if err := b.Put([]byte(name), data); err != nil {
+			return fmt.Errorf("saving sample %v stats: %w", name, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) GetSampleStats() (map[string]SampleStats, error) {
+	result := make(map[string]SampleStats)
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(sampleDataBucket))
+		return b.ForEach(func(k, v []byte) error {
+			var st SampleStats
+			if err := json.Unmarshal(v, &st); err != nil {
+				return fmt.Errorf("parsing sample %v stats: %w", string(k), err)
+			}
+			result[string(k)] = st
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return result, nil
+}
+
+func (s Storage) DeleteSampleStats(name string) error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(sampleDataBucket))
+		if err := b.Delete([]byte(name)); err != nil {
+			return fmt.Errorf("deleting sample %v stats: %w", name, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ChatSettings are configured by chat admins.
+type ChatSettings struct {
+	// Shadow makes the bot only audit the actions it would take.
+	Shadow bool `json:"shadow,omitempty"`
+	// ShadowDetectors only audit their hits, without affecting the verdict.
+	ShadowDetectors []string `json:"shadow_detectors,omitempty"`
+	// LogChatID is where actions are reported, if set.
+	LogChatID int64 `json:"log_chat_id,omitempty"`
+	// VoteTimeout is how long vote prompts stay open, zero means the default.
+	VoteTimeout time.Duration `json:"vote_timeout,omitempty"`
+	// VoteExpiry is how expired votes are resolved, empty means the default.
+	VoteExpiry string `json:"vote_expiry,omitempty"`
+	// MuteSuspects restricts the sender while the vote on their message is pending.
+	MuteSuspects bool `json:"mute_suspects,omitempty"`
+	// HideSuspicious also deletes the message until the vote resolves, it's reposted if it's not spam.
+	HideSuspicious bool `json:"hide_suspicious,omitempty"`
+	// Sanctions is the escalation ladder, the n-th strike applies the n-th step
+	// and the last one is repeated. Empty means the default.
+	Sanctions []string `json:"sanctions,omitempty"`
+	// StrikeDecay is how long it takes for a strike to expire, zero means the default.
+	StrikeDecay time.Duration `json:"strike_decay,omitempty"`
+}
+
+func (c ChatSettings) IsDetectorShadowed(detector string) bool {
+	for _, d := range c.ShadowDetectors {
+		if d == detector {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Storage) GetChatSettings(chatID int64) (ChatSettings, error) {
+	var settings ChatSettings
+	data, err := s.getChatKey(chatSettingsKey(chatID))
+	if err != nil || data == nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("parsing chat settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (s Storage) SetChatSettings(chatID int64, settings ChatSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("serializing chat settings: %w", err)
+	}
+	return s.setChatKey(chatSettingsKey(chatID), data)
+}
@@ -3,13 +3,17 @@ package storage
 import (
 	"fmt"
 	"path"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
 
+// openTimeout limits waiting for the database lock held by another process.
+const openTimeout = 5 * time.Second
+
 func New(dir string) (*Storage, error) {
 	dbPath := path.Join(dir, "data.db")
-	db, err := bolt.Open(dbPath, 0600, nil)
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: openTimeout})
 	if err != nil {
 		return nil, fmt.Errorf("opening database file: %w", err)
 	}
@@ -17,9 +21,43 @@ func New(dir string) (*Storage, error) {
 	if err = s.initBuckets(); err != nil {
 		return nil, fmt.Errorf("initilizing buckets: %w", err)
 	}
+	if err = s.migrateTrust(); err != nil {
+		return nil, fmt.Errorf("migrating trust: %w", err)
+	}
+	return &s, nil
+}
+
+// OpenReadOnly opens the database for inspection, without initializing or migrating it,
+// so that it can be read by several processes at once.
+func OpenReadOnly(dir string) (*Storage, error) {
+	dbPath := path.Join(dir, "data.db")
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening database file: %w", err)
+	}
+	s := Storage{db}
+	if err = s.checkBuckets(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	return &s, nil
 }
 
 type Storage struct {
 	db *bolt.DB
 }
+
+func (s Storage) Close() error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("closing database: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the database can be read.
+func (s Storage) Ping() error {
+	if err := s.db.View(func(tx *bolt.Tx) error { return nil }); err != nil {
+		return fmt.Errorf("reading database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+	if err := s.TrustUser(1, 0, "test"); err != nil {
+		t.Fatalf("trusting user: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("closing storage: %v", err)
+	}
+
+	ro, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatalf("opening storage: %v", err)
+	}
+	defer ro.Close()
+	trust, err := ro.GetTrust(1, 0)
+	if err != nil {
+		t.Fatalf("getting trust: %v", err)
+	}
+	if trust == nil || trust.Reason != "test" {
+		t.Fatalf("got trust %+v, expected the stored one", trust)
+	}
+	if err := ro.TrustUser(2, 0, "test"); err == nil {
+		t.Fatal("trusted user in read-only storage")
+	}
+}
+
+func TestOpenReadOnlyMissingDatabase(t *testing.T) {
+	if s, err := OpenReadOnly(t.TempDir()); err == nil {
+		_ = s.Close()
+		t.Fatal("opened missing database")
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type strikes struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// decayed drops a strike for every full decay period since the last one.
+func (s strikes) decayed(now time.Time, decay time.Duration) int {
+	if decay <= 0 {
+		return s.Count
+	}
+	count := s.Count - int(now.Sub(s.Last)/decay)
+	if count < 0 {
+		return 0
+	}
+	return count
+}
+
+// AddStrike records a strike of the user in the chat and returns their strike count.
+func (s Storage) AddStrike(chatID int64, userID int64, now time.Time, decay time.Duration) (int, error) {
+	key := chatUserStrikesKey(chatID, userID)
+	var st strikes
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(chatDataBucket))
+		if data := b.Get([]byte(key)); data != nil {
+			if err := json.Unmarshal(data, &st); err != nil {
+				return fmt.Errorf("parsing strikes %v: %w", key, err)
+			}
+		}
+		st = strikes{Count: st.decayed(now, decay) + 1, Last: now}
+		data, err := json.Marshal(st)
+		if err != nil {
+			return fmt.Errorf("serializing strikes: %w", err)
+		}
+		if err := b.Put([]byte(key), data); err != nil {
+			return fmt.Errorf("saving strikes %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return st.Count, nil
+}
+
+func (s Storage) GetStrikes(chatID int64, userID int64, now time.Time, decay time.Duration) (int, error) {
+	data, err := s.getChatKey(chatUserStrikesKey(chatID, userID))
+	if err != nil || data == nil {
+		return 0, err
+	}
+	var st strikes
+	if err := json.Unmarshal(data, &st); err != nil {
+		return 0, fmt.Errorf("parsing strikes: %w", err)
+	}
+	return st.decayed(now, decay), nil
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// legacyTrustKey is the user context key trust was kept in before it had scopes.
+const legacyTrustKey = "trusted"
+
+// Trust exempts the user from the checks, either everywhere or in a chat.
+type Trust struct {
+	UserID int64 `json:"user_id"`
+	// ChatID limits the trust to the chat, zero means everywhere.
+	ChatID int64     `json:"chat_id,omitempty"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+	// Revoked trust overrides the global trust in the chat,
+	// and the user's reputation doesn't count until they are trusted again.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+func (s Storage) SetTrust(t Trust) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("serializing trust: %w", err)
+	}
+	key := formatTrustKey(t.UserID, t.ChatID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte(trustBucket)).Put(key, data); err != nil {
+			return fmt.Errorf("saving trust %v: %w", string(key), err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s Storage) TrustUser(userID int64, chatID int64, reason string) error {
+	return s.SetTrust(Trust{UserID: userID, ChatID: chatID, Reason: reason, Time: time.Now()})
+}
+
+// UntrustUser revokes the trust in the chat, or everywhere if chatID is zero.
+func (s Storage) UntrustUser(userID int64, chatID int64, reason string) error {
+	revoked := Trust{UserID: userID, ChatID: chatID, Reason: reason, Time: time.Now(), Revoked: true}
+	data, err := json.Marshal(revoked)
+	if err != nil {
+		return fmt.Errorf("serializing trust: %w", err)
+	}
+	prefix := []byte(fmt.Sprintf("%d:", userID))
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(trustBucket))
+		if chatID == 0 {
+			var keys [][]byte
+			c := b.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return fmt.Errorf("deleting trust %v: %w", string(k), err)
+				}
+			}
+		}
+		key := formatTrustKey(userID, chatID)
+		if err := b.Put(key, data); err != nil {
+			return fmt.Errorf("saving trust %v: %w", string(key), err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// GetTrust returns the trust of the user in the chat, the chat's record takes
+// precedence over the global one. It's nil if there's none, and might be revoked.
+func (s Storage) GetTrust(userID int64, chatID int64) (*Trust, error) {
+	var t *Trust
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(trustBucket))
+		for _, scope := range []int64{chatID, 0} {
+			data := b.Get(formatTrustKey(userID, scope))
+			if data == nil {
+				continue
+			}
+			t = new(Trust)
+			if err := json.Unmarshal(data, t); err != nil {
+				return fmt.Errorf("parsing trust of %v: %w", userID, err)
+			}
+			return nil
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return t, nil
+}
+
+func (s Storage) IsUserTrusted(userID int64, chatID int64) (bool, error) {
+	t, err := s.GetTrust(userID, chatID)
+	if err != nil {
+		return false, err
+	}
+	return t != nil && !t.Revoked, nil
+}
+
+// GetTrustedUsers returns a page of the trust records in effect, ordered by user,
+// along with their total number. If chatID is not zero, it's the record each user's
+// trust in the chat comes from, as GetTrust resolves it.
+func (s Storage) GetTrustedUsers(chatID int64, offset int, limit int) ([]Trust, int, error) {
+	var trusted []Trust
+	effective := make(map[int64]Trust)
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(trustBucket)).ForEach(func(k, v []byte) error {
+			var t Trust
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("parsing trust %v: %w", string(k), err)
+			}
+			switch {
+			case chatID == 0:
+				if !t.Revoked {
+					trusted = append(trusted, t)
+				}
+			case t.ChatID == chatID:
+				effective[t.UserID] = t
+			case t.ChatID == 0:
+				if _, ok := effective[t.UserID]; !ok {
+					effective[t.UserID] = t
+				}
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	for _, t := range effective {
+		if !t.Revoked {
+			trusted = append(trusted, t)
+		}
+	}
+	sort.Slice(trusted, func(i, j int) bool {
+		if trusted[i].UserID != trusted[j].UserID {
+			return trusted[i].UserID < trusted[j].UserID
+		}
+		return trusted[i].ChatID < trusted[j].ChatID
+	})
+
+	total := len(trusted)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	trusted = trusted[offset:]
+	if limit > 0 && len(trusted) > limit {
+		trusted = trusted[:limit]
+	}
+	return trusted, total, nil
+}
+
+// migrateTrust moves the trust kept in the user context to the trust records,
+// and drops the trust granted by the tenure and activity rules, reputation replaced them.
+func (s Storage) migrateTrust() error {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		trust := tx.Bucket([]byte(trustBucket))
+		var auto [][]byte
+		if err := trust.ForEach(func(k, v []byte) error {
+			var t struct {
+				Auto bool `json:"auto"`
+			}
+			if err := json.Unmarshal(v, &t); err != nil {
+				return fmt.Errorf("parsing trust %v: %w", string(k), err)
+			}
+			if t.Auto {
+				auto = append(auto, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating trust: %w", err)
+		}
+		for _, k := range auto {
+			if err := trust.Delete(k); err != nil {
+				return fmt.Errorf("deleting trust %v: %w", string(k), err)
+			}
+		}
+
+		users := tx.Bucket([]byte(userDataBucket))
+		var trusted [][]byte
+		if err := users.ForEach(func(k, v []byte) error {
+			// Users are nested buckets.
+			if v == nil && string(users.Bucket(k).Get([]byte(legacyTrustKey))) == "yes" {
+				trusted = append(trusted, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating users: %w", err)
+		}
+
+		for _, k := range trusted {
+			userID, err := strconv.ParseInt(string(k), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing user id %v: %w", string(k), err)
+			}
+			data, err := json.Marshal(Trust{UserID: userID, Reason: "trusted before scopes", Time: time.Now()})
+			if err != nil {
+				return fmt.Errorf("serializing trust: %w", err)
+			}
+			if err := trust.Put(formatTrustKey(userID, 0), data); err != nil {
+				return fmt.Errorf("saving trust of %v: %w", userID, err)
+			}
+			if err := users.Bucket(k).Delete([]byte(legacyTrustKey)); err != nil {
+				return fmt.Errorf("deleting legacy trust of %v: %w", userID, err)
+			}
+			logrus.Infof("Migrated trust of user %d", userID)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetTrustedUsers(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+	defer s.Close()
+
+	const chatID, otherChatID = -1001000000001, -1001000000002
+	for _, tr := range []Trust{
+		{UserID: 1},
+		{UserID: 1, ChatID: chatID, Reason: "chat"},
+		{UserID: 2},
+		{UserID: 2, ChatID: chatID, Revoked: true},
+		{UserID: 3, ChatID: otherChatID},
+		{UserID: 10},
+		{UserID: 9, ChatID: chatID},
+	} {
+		if err := s.SetTrust(tr); err != nil {
+			t.Fatalf("setting trust: %v", err)
+		}
+	}
+
+	users := func(trusted []Trust) (ids []int64) {
+		for _, tr := range trusted {
+			ids = append(ids, tr.UserID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		name          string
+		chatID        int64
+		offset, limit int
+		want          []int64
+		total         int
+	}{
+		{name: "all", want: []int64{1, 1, 2, 3, 9, 10}, total: 6},
+		{name: "chat", chatID: chatID, want: []int64{1, 9, 10}, total: 3},
+		{name: "page", chatID: chatID, offset: 1, limit: 1, want: []int64{9}, total: 3},
+		{name: "past the end", chatID: chatID, offset: 5, total: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			trusted, total, err := s.GetTrustedUsers(tc.chatID, tc.offset, tc.limit)
+			if err != nil {
+				t.Fatalf("getting trusted users: %v", err)
+			}
+			if got := users(trusted); !reflect.DeepEqual(got, tc.want) || total != tc.total {
+				t.Fatalf("got %v of %d, expected %v of %d", got, total, tc.want, tc.total)
+			}
+		})
+	}
+
+	trusted, _, err := s.GetTrustedUsers(chatID, 0, 1)
+	if err != nil {
+		t.Fatalf("getting trusted users: %v", err)
+	}
+	if trusted[0].Reason != "chat" {
+		t.Fatalf("got %+v, expected the chat's record to take precedence", trusted[0])
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// UserSummary describes a user the bot has seen.
+type UserSummary struct {
+	ID        int64     `json:"id"`
+	FirstSeen time.Time `json:"first_seen,omitempty"`
+	// Messages are the message counts by chat.
+	Messages map[int64]int64 `json:"messages"`
+}
+
+// GetUsers returns a page of the users ordered by ID, along with their total number.
+// Only the users that sent messages to the chat are returned if chatID is not zero.
+func (s Storage) GetUsers(chatID int64, offset int, limit int) ([]UserSummary, int, error) {
+	var users []UserSummary
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(userDataBucket))
+		return b.ForEach(func(uk, v []byte) error {
+			if v != nil {
+				return nil
+			}
+			id, err := strconv.ParseInt(string(uk), 10, 64)
+			if err != nil {
+				return fmt.Errorf("parsing user id %v: %w", string(uk), err)
+			}
+			u := UserSummary{ID: id, Messages: make(map[int64]int64)}
+			if err := b.Bucket(uk).ForEach(func(k, v []byte) error {
+				if v == nil {
+					return nil
+				}
+				if string(k) == firstSeenKey {
+					nano, err := strconv.ParseInt(string(v), 10, 64)
+					if err != nil {
+						return fmt.Errorf("parsing user %d first seen (%v): %w", id, string(v), err)
+					}
+					u.FirstSeen = time.Unix(0, nano)
+					return nil
+				}
+				if chat, ok := parseMessageCountKey(string(k)); ok {
+					count, err := strconv.ParseInt(string(v), 10, 64)
+					if err != nil {
+						return fmt.Errorf("parsing user %d message count %v: %w", id, string(k), err)
+					}
+					u.Messages[chat] = count
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if _, ok := u.Messages[chatID]; chatID == 0 || ok {
+				users = append(users, u)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, 0, fmt.Errorf("executing transaction: %w", err)
+	}
+
+	// The keys are ordered as strings.
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	total := len(users)
+	if offset > total {
+		offset = total
+	}
+	users = users[offset:]
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+	}
+	return users, total, nil
+}
@@ -18,22 +18,87 @@ func chatMessageCountKey(chatID int64) string {
 	return fmt.Sprintf("chat:%d:msg_count", chatID)
 }
 
+func chatRecentMessagesBucketKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d:recent", chatID)
+}
+
+// formatMessageID pads the message id, so that bucket keys are ordered by id.
+func formatMessageID(messageID int) []byte {
+	return []byte(fmt.Sprintf("%012d", messageID))
+}
+
+func formatSequence(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", seq))
+}
+
 func chatMessageKey(chatID int64, messageID int) string {
 	return fmt.Sprintf("chat_msg:%d:%d", chatID, messageID)
 }
 
+const votesBucketSuffix = ":votes"
+
 func chatMessageVotesBucketKey(chatID int64, messageID int) string {
-	return fmt.Sprintf("%s:votes", chatMessageKey(chatID, messageID))
+	return chatMessageKey(chatID, messageID) + votesBucketSuffix
+}
+
+func chatMessageReportsBucketKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%s:reports", chatMessageKey(chatID, messageID))
+}
+
+func chatSettingsKey(chatID int64) string {
+	return fmt.Sprintf("chat_settings:%d", chatID)
+}
+
+func chatDetectionKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%s:detection", chatMessageKey(chatID, messageID))
+}
+
+func chatAlertKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%s:alert_for", chatMessageKey(chatID, messageID))
+}
+
+func chatVotePromptKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("%s:vote_prompt", chatMessageKey(chatID, messageID))
+}
+
+func chatAlbumBucketKey(chatID int64, groupID string) string {
+	return fmt.Sprintf("chat_album:%d:%s", chatID, groupID)
+}
+
+func chatUserReputationKey(chatID int64, userID int64) string {
+	return fmt.Sprintf("chat_reputation:%d:%d", chatID, userID)
 }
 
-func formatVote(vote bool) []byte {
+func chatUserStrikesKey(chatID int64, userID int64) string {
+	return fmt.Sprintf("chat_strikes:%d:%d", chatID, userID)
+}
+
+func chatUserMuteKey(chatID int64, userID int64) string {
+	return fmt.Sprintf("chat_mute:%d:%d", chatID, userID)
+}
+
+func formatVote(vote bool, weight int) []byte {
 	if vote {
-		return []byte("1")
+		return []byte(fmt.Sprintf("1:%d", weight))
 	} else {
-		return []byte("0")
+		return []byte(fmt.Sprintf("0:%d", weight))
+	}
+}
+
+// parseVote also accepts votes from before they had weights.
+func parseVote(data []byte) (vote bool, weight int) {
+	value, w, found := bytes.Cut(data, []byte(":"))
+	weight = 1
+	if found {
+		if parsed, err := strconv.Atoi(string(w)); err == nil {
+			weight = parsed
+		}
 	}
+	return bytes.Equal(value, []byte("1")), weight
 }
 
-func parseVote(data []byte) bool {
-	return bytes.Equal(data, []byte("1"))
+// formatTrustKey keeps the trust records of a user together, they aren't ordered by scope:
+// the records of chats, whose IDs are negative, sort before the global one.
+func formatTrustKey(userID int64, chatID int64) []byte {
+	return []byte(fmt.Sprintf("%d:%d", userID, chatID))
 }
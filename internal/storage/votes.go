@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PendingVote is a vote prompt waiting for its deadline.
+type PendingVote struct {
+	ChatID   int64     `json:"chat_id"`
+	PromptID int       `json:"prompt_id"`
+	Deadline time.Time `json:"deadline"`
+	// Message is the message being voted on, as received.
+	Message json.RawMessage `json:"message"`
+}
+
+func (s Storage) AddPendingVote(vote PendingVote) error {
+	data, err := json.Marshal(vote)
+	if err != nil {
+		return fmt.Errorf("serializing pending vote: %w", err)
+	}
+	key := chatMessageKey(vote.ChatID, vote.PromptID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(pendingVotesBucket))
+		if err := b.Put([]byte(key), data); err != nil {
+			return fmt.Errorf("saving pending vote %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// SetVotePrompt remembers the prompt of the vote on the message.
+func (s Storage) SetVotePrompt(chatID int64, messageID int, promptID int) error {
+	return s.setChatKey(chatVotePromptKey(chatID, messageID), intToBytes(int64(promptID)))
+}
+
+// GetVotePrompt returns the prompt of the last vote on the message, or 0 if there was none.
+func (s Storage) GetVotePrompt(chatID int64, messageID int) (int, error) {
+	data, err := s.getChatKey(chatVotePromptKey(chatID, messageID))
+	if err != nil || data == nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("parsing vote prompt %v: %w", string(data), err)
+	}
+	return id, nil
+}
+
+// GetPendingVote returns nil if the vote is not pending.
+func (s Storage) GetPendingVote(chatID int64, promptID int) (*PendingVote, error) {
+	key := chatMessageKey(chatID, promptID)
+	var vote *PendingVote
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(pendingVotesBucket)).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		vote = new(PendingVote)
+		if err := json.Unmarshal(data, vote); err != nil {
+			return fmt.Errorf("parsing pending vote %v: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return vote, nil
+}
+
+func (s Storage) GetPendingVotes() ([]PendingVote, error) {
+	var votes []PendingVote
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(pendingVotesBucket))
+		if err := b.ForEach(func(k, v []byte) error {
+			var vote PendingVote
+			if err := json.Unmarshal(v, &vote); err != nil {
+				return fmt.Errorf("parsing pending vote %v: %w", string(k), err)
+			}
+			votes = append(votes, vote)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating pending votes: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("executing transaction: %w", err)
+	}
+	return votes, nil
+}
+
+// ResolveVote forgets the pending vote along with the votes cast and the prompt of the message.
+func (s Storage) ResolveVote(chatID int64, promptID int) error {
+	key := chatMessageKey(chatID, promptID)
+	bk := chatMessageVotesBucketKey(chatID, promptID)
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket([]byte(pendingVotesBucket))
+		b := tx.Bucket([]byte(chatDataBucket))
+		if data := pending.Get([]byte(key)); data != nil {
+			var vote PendingVote
+			if err := json.Unmarshal(data, &vote); err != nil {
+				return fmt.Errorf("parsing pending vote %v: %w", key, err)
+			}
+			var msg struct {
+				MessageID int `json:"message_id"`
+			}
+			if err := json.Unmarshal(vote.Message, &msg); err != nil {
+				return fmt.Errorf("parsing voted message %v: %w", key, err)
+			}
+			// The message might have got a newer prompt.
+			promptKey := []byte(chatVotePromptKey(chatID, msg.MessageID))
+			if string(b.Get(promptKey)) == strconv.Itoa(promptID) {
+				if err := b.Delete(promptKey); err != nil {
+					return fmt.Errorf("deleting vote prompt %v: %w", string(promptKey), err)
+				}
+			}
+		}
+		if err := pending.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("deleting pending vote %v: %w", key, err)
+		}
+		if b.Bucket([]byte(bk)) == nil {
+			return nil
+		}
+		if err := b.DeleteBucket([]byte(bk)); err != nil {
+			return fmt.Errorf("deleting bucket %v: %w", bk, err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("executing transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleVotes deletes the votes and the prompt records of prompts that aren't pending anymore,
+// e.g. left from before the votes expired. It returns the number of deleted records.
+func (s Storage) DeleteStaleVotes() (int, error) {
+	deleted := 0
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		pending := tx.Bucket([]byte(pendingVotesBucket))
+		b := tx.Bucket([]byte(chatDataBucket))
+
+		var stale, prompts [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			// Nested buckets have nil values.
+			switch {
+			case v == nil && bytes.HasSuffix(k, []byte(votesBucketSuffix)):
+				if pending.Get([]byte(strings.TrimSuffix(string(k), votesBucketSuffix))) == nil {
+					stale = append(stale, append([]byte(nil), k...))
+				}
+			case v != nil && bytes.HasSuffix(k, []byte(":vote_prompt")):
+				var (
+					chatID    int64
+					messageID int
+				)
+				_, scanErr := fmt.Sscanf(string(k), "chat_msg:%d:%d:vote_prompt", &chatID, &messageID)
+				promptID, err := strconv.Atoi(string(v))
+				if scanErr != nil || err != nil || pending.Get([]byte(chatMessageKey(chatID, promptID))) == nil {
+					prompts = append(prompts, append([]byte(nil), k...))
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("iterating chat data: %w", err)
+		}
+		for _, k := range stale {
+			if err := b.DeleteBucket(k); err != nil {
+				return fmt.Errorf("deleting bucket %v: %w", string(k), err)
+			}
+		}
+		for _, k := range prompts {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("deleting vote prompt %v: %w", string(k), err)
+			}
+		}
+		deleted = len(stale) + len(prompts)
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("executing transaction: %w", err)
+	}
+	return deleted, nil
+}
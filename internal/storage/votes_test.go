@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVotePromptsAreForgotten(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+	defer s.Close()
+
+	const chatID = -1001000000001
+	vote := PendingVote{ChatID: chatID, PromptID: 100, Deadline: time.Now(), Message: []byte(`{"message_id": 5}`)}
+	if err := s.AddPendingVote(vote); err != nil {
+		t.Fatalf("adding pending vote: %v", err)
+	}
+	if err := s.SetVotePrompt(chatID, 5, 100); err != nil {
+		t.Fatalf("setting vote prompt: %v", err)
+	}
+	// Left from before the prompts were deleted along with the votes.
+	if err := s.SetVotePrompt(chatID, 6, 101); err != nil {
+		t.Fatalf("setting vote prompt: %v", err)
+	}
+
+	if err := s.ResolveVote(chatID, 100); err != nil {
+		t.Fatalf("resolving vote: %v", err)
+	}
+	if deleted, err := s.DeleteStaleVotes(); err != nil || deleted != 1 {
+		t.Fatalf("deleted %d stale votes (%v), expected the stale prompt", deleted, err)
+	}
+	for _, messageID := range []int{5, 6} {
+		if promptID, err := s.GetVotePrompt(chatID, messageID); err != nil || promptID != 0 {
+			t.Fatalf("got prompt %d (%v) of message %d, expected none", promptID, err, messageID)
+		}
+	}
+}